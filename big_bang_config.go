@@ -9,29 +9,29 @@ import (
 
 //BigBangConfig is the structure of the provided  big_bang_config.yaml
 type BigBangConfig struct {
-	SpawnDimension `yaml:"spawn_dimension"`
-	EnergyLevel    uint64 `yaml:"energy_level"`
-	CellAmount     uint64 `yaml:"cell_amount"`
-	DnaLengthRange `yaml:"dna_length_range"`
+	SpawnDimension `yaml:"spawn_dimension" json:"spawn_dimension"`
+	EnergyLevel    uint64 `yaml:"energy_level" json:"energy_level"`
+	CellAmount     uint64 `yaml:"cell_amount" json:"cell_amount"`
+	DnaLengthRange `yaml:"dna_length_range" json:"dna_length_range"`
 }
 
 //SpawnDimension ...
 type SpawnDimension struct {
-	Start Vector `yaml:"start"`
-	End   Vector `yaml:"end"`
+	Start Vector `yaml:"start" json:"start"`
+	End   Vector `yaml:"end" json:"end"`
 }
 
 // DnaLengthRange ...
 type DnaLengthRange struct {
-	Min uint64 `yaml:"min"`
-	Max uint64 `yaml:"max"`
+	Min uint64 `yaml:"min" json:"min"`
+	Max uint64 `yaml:"max" json:"max"`
 }
 
 //Vector ...
 type Vector struct {
-	X float32 `yaml:"x"`
-	Y float32 `yaml:"y"`
-	Z float32 `yaml:"z"`
+	X float32 `yaml:"x" json:"x"`
+	Y float32 `yaml:"y" json:"y"`
+	Z float32 `yaml:"z" json:"z"`
 }
 
 //BigBangConfigFromPath loads the yaml-file the path is pointing to and returns a BigBangConfig with values on success.
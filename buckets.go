@@ -6,6 +6,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/codeuniversity/al-master/filters"
 	"github.com/codeuniversity/al-proto"
 )
 
@@ -59,23 +60,28 @@ func bucketKeyFor(pos *proto.Vector, batchSize uint) BucketKey {
 	return NewBucketKey(batchXPosition, batchYPosition, batchZPosition)
 }
 
-//SurroundingKeys of the key, including diagonals
-func (k BucketKey) SurroundingKeys(width int) []BucketKey {
-	width64 := int64(width)
+//coordinates of the key, false if it isn't of the form "<x>/<y>/<z>"
+func (k BucketKey) coordinates() (x, y, z int64, ok bool) {
 	components := strings.Split(string(k), "/")
 	if len(components) != 3 {
-		return nil
+		return
 	}
-	x, err := strconv.ParseInt(components[0], 10, 32)
-	if err != nil {
-		return nil
-	}
-	y, err := strconv.ParseInt(components[1], 10, 32)
-	if err != nil {
-		return nil
+	parsed := [3]int64{}
+	for i, component := range components {
+		value, err := strconv.ParseInt(component, 10, 32)
+		if err != nil {
+			return
+		}
+		parsed[i] = value
 	}
-	z, err := strconv.ParseInt(components[2], 10, 32)
-	if err != nil {
+	return parsed[0], parsed[1], parsed[2], true
+}
+
+//SurroundingKeys of the key, including diagonals
+func (k BucketKey) SurroundingKeys(width int) []BucketKey {
+	width64 := int64(width)
+	x, y, z, ok := k.coordinates()
+	if !ok {
 		return nil
 	}
 	keys := []BucketKey{}
@@ -92,6 +98,50 @@ func (k BucketKey) SurroundingKeys(width int) []BucketKey {
 	return keys
 }
 
+//Bounds of the positions of the cells in the bucket, see axisBatchPositionFor.
+//A positive key k covers (k-width, k], a negative one [k, k+width) and 0 only covers 0, the bounds include both ends
+func (k BucketKey) Bounds(width int) (min, max filters.Point, ok bool) {
+	x, y, z, ok := k.coordinates()
+	if !ok {
+		return
+	}
+	for axis, key := range []int64{x, y, z} {
+		switch {
+		case key > 0:
+			min[axis], max[axis] = float64(key-int64(width)), float64(key)
+		case key < 0:
+			min[axis], max[axis] = float64(key), float64(key+int64(width))
+		}
+	}
+	return min, max, true
+}
+
+//CellsIn the buckets that intersect the region, which may include cells outside of it
+func (b Buckets) CellsIn(region filters.Region, width int) []*proto.Cell {
+	cells := []*proto.Cell{}
+	for key, bucketCells := range b {
+		min, max, ok := key.Bounds(width)
+		if !ok || region.IntersectsBox(min, max) {
+			cells = append(cells, bucketCells...)
+		}
+	}
+	return cells
+}
+
+//bucketIndex gives the websocket access to the buckets, so it can skip the ones outside the region of a filter
+type bucketIndex struct {
+	buckets Buckets
+	width   int
+}
+
+func (i *bucketIndex) AllCells() []*proto.Cell {
+	return i.buckets.AllCells()
+}
+
+func (i *bucketIndex) CellsIn(region filters.Region) []*proto.Cell {
+	return i.buckets.CellsIn(region, i.width)
+}
+
 func axisBatchPositionFor(cellAxisPosition float32, batchSize uint) int {
 	if cellAxisPosition >= 0 {
 		return int(math.Ceil(float64(cellAxisPosition/float32(batchSize))) * float64(batchSize))
@@ -7,8 +7,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/codeuniversity/al-master/filters"
 	"github.com/codeuniversity/al-proto"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestRandomFloatBetweenTwoFloats(t *testing.T) {
@@ -106,6 +108,57 @@ func TestCreateBuckets(t *testing.T) {
 	})
 }
 
+func TestBucketBounds(t *testing.T) {
+	min, max, ok := BucketKey("4/-4/0").Bounds(4)
+	require.True(t, ok)
+	assert.Equal(t, filters.Point{0, -4, 0}, min)
+	assert.Equal(t, filters.Point{4, 0, 0}, max)
+
+	_, _, ok = BucketKey("4/-4").Bounds(4)
+	assert.False(t, ok)
+
+	cells := gridCells(-20, 20, 1.5)
+	buckets := CreateBuckets(cells, 4)
+	for key, bucketCells := range buckets {
+		min, max, _ := key.Bounds(4)
+		for _, cell := range bucketCells {
+			box := &filters.Box{Min: min, Max: max}
+			assert.True(t, box.Contains(filters.Point{float64(cell.Pos.X), float64(cell.Pos.Y), float64(cell.Pos.Z)}), "%v in %v", cell.Pos, key)
+		}
+	}
+}
+
+func TestCellsIn(t *testing.T) {
+	cells := gridCells(-20, 20, 1.5)
+	buckets := CreateBuckets(cells, 4)
+	region := &filters.Sphere{Center: filters.Point{5, -5, 5}, Radius: 6}
+
+	candidates := buckets.CellsIn(region, 4)
+	assert.True(t, len(candidates) < len(cells), "buckets outside of the sphere are skipped")
+	isCandidate := map[*proto.Cell]bool{}
+	for _, cell := range candidates {
+		isCandidate[cell] = true
+	}
+	for _, cell := range cells {
+		if region.Contains(filters.Point{float64(cell.Pos.X), float64(cell.Pos.Y), float64(cell.Pos.Z)}) {
+			assert.True(t, isCandidate[cell], "%v is within the sphere", cell.Pos)
+		}
+	}
+}
+
+//gridCells from min to max on all axes with step between them
+func gridCells(min, max, step float32) []*proto.Cell {
+	cells := []*proto.Cell{}
+	for x := min; x <= max; x += step {
+		for y := min; y <= max; y += step {
+			for z := min; z <= max; z += step {
+				cells = append(cells, &proto.Cell{Pos: &proto.Vector{X: x, Y: y, Z: z}})
+			}
+		}
+	}
+	return cells
+}
+
 func BenchmarkCreateBuckets(b *testing.B) {
 	cells := createRandomCells(uint(512000), -1000, 1000, -1000, 1000, -1000, 1000)
 
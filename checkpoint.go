@@ -0,0 +1,63 @@
+package master
+
+import (
+	"time"
+)
+
+//checkpointIfDue saves the state if enough time steps or time passed since the last checkpoint
+func (s *Server) checkpointIfDue() {
+	if !s.checkpointDue(time.Now()) {
+		return
+	}
+	if _, err := s.checkpoint(); err != nil {
+		stateLogger.WithError(err).With("time_step", s.TimeStep).Error("checkpoint could not be saved")
+	}
+}
+
+func (s *Server) checkpointDue(now time.Time) bool {
+	if s.CheckpointEverySteps > 0 && s.TimeStep-s.lastCheckpointTimeStep >= s.CheckpointEverySteps {
+		return true
+	}
+	if s.CheckpointInterval > 0 && now.Sub(s.lastCheckpointTime) >= s.CheckpointInterval {
+		return true
+	}
+	return false
+}
+
+//checkpoint saves the state and removes the oldest states exceeding the CheckpointRetention.
+//Returns the name of the saved state
+func (s *Server) checkpoint() (string, error) {
+	now := time.Now()
+	//a clock that didn't move since the last checkpoint would reuse its name
+	if !now.After(s.lastCheckpointTime) {
+		now = s.lastCheckpointTime.Add(time.Nanosecond)
+	}
+	s.lastCheckpointTime = now
+	s.lastCheckpointTimeStep = s.TimeStep
+
+	name := StateName(s.lastCheckpointTime)
+	if err := s.StateStore.Save(name, s.SimulationState); err != nil {
+		return "", err
+	}
+	return name, s.pruneCheckpoints(name)
+}
+
+//pruneCheckpoints removes the oldest states exceeding the CheckpointRetention after saved was saved.
+//The states folder of a named run only holds the states of the run, without a RunName it is shared by all unnamed runs,
+//so only the checkpoints saved by this server are removed
+func (s *Server) pruneCheckpoints(saved string) error {
+	if s.RunName != "" {
+		return pruneStates(s.StateStore, s.CheckpointRetention)
+	}
+	s.checkpointNames = append(s.checkpointNames, saved)
+	if s.CheckpointRetention <= 0 {
+		return nil
+	}
+	for len(s.checkpointNames) > s.CheckpointRetention {
+		if err := s.StateStore.Delete(s.checkpointNames[0]); err != nil {
+			return err
+		}
+		s.checkpointNames = s.checkpointNames[1:]
+	}
+	return nil
+}
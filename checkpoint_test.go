@@ -0,0 +1,97 @@
+package master
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpointDue(t *testing.T) {
+	now := time.Now()
+	newServer := func(config ServerConfig) *Server {
+		s := NewServer(config)
+		s.SimulationState = NewSimulationState(Buckets{})
+		s.lastCheckpointTime = now
+		return s
+	}
+
+	t.Run("every n steps", func(t *testing.T) {
+		s := newServer(ServerConfig{CheckpointEverySteps: 10})
+		s.TimeStep = 9
+		assert.False(t, s.checkpointDue(now))
+		s.TimeStep = 10
+		assert.True(t, s.checkpointDue(now))
+	})
+	t.Run("every interval", func(t *testing.T) {
+		s := newServer(ServerConfig{CheckpointInterval: time.Minute})
+		assert.False(t, s.checkpointDue(now.Add(59*time.Second)))
+		assert.True(t, s.checkpointDue(now.Add(time.Minute)))
+	})
+	t.Run("disabled by default", func(t *testing.T) {
+		s := newServer(ServerConfig{})
+		s.TimeStep = 1000
+		assert.False(t, s.checkpointDue(now.Add(time.Hour)))
+	})
+}
+
+func TestCheckpointsWithinTheSameSecond(t *testing.T) {
+	defer cleanup()
+	s := NewServer(ServerConfig{})
+	s.SimulationState = NewSimulationState(Buckets{})
+	s.StateStore = NewFileStateStore(testStatesFolderName)
+
+	first, err := s.checkpoint()
+	assert.NoError(t, err)
+	second, err := s.checkpoint()
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+
+	names, err := s.StateStore.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{first, second}, names)
+	latest, err := s.StateStore.Latest()
+	assert.NoError(t, err)
+	assert.Equal(t, second, latest)
+}
+
+func TestCheckpointRetention(t *testing.T) {
+	defer cleanup()
+	store := NewFileStateStore(testStatesFolderName)
+	other := NewServer(ServerConfig{})
+	other.SimulationState = NewSimulationState(Buckets{})
+	other.StateStore = store
+	otherName, err := other.checkpoint()
+	require.NoError(t, err)
+
+	t.Run("unnamed runs only prune their own checkpoints", func(t *testing.T) {
+		s := NewServer(ServerConfig{CheckpointRetention: 2})
+		s.SimulationState = NewSimulationState(Buckets{})
+		s.StateStore = store
+		s.lastCheckpointTime = other.lastCheckpointTime
+
+		saved := []string{}
+		for i := 0; i < 4; i++ {
+			name, err := s.checkpoint()
+			require.NoError(t, err)
+			saved = append(saved, name)
+		}
+
+		names, err := store.List()
+		require.NoError(t, err)
+		assert.Equal(t, []string{otherName, saved[2], saved[3]}, names)
+	})
+
+	t.Run("named runs prune all states of the run", func(t *testing.T) {
+		s := NewServer(ServerConfig{StatesDir: testStatesFolderName, RunName: "exp1", CheckpointRetention: 1})
+		s.SimulationState = NewSimulationState(Buckets{})
+		require.NoError(t, s.StateStore.Save("STATE_20190301120000", s.SimulationState))
+
+		name, err := s.checkpoint()
+		require.NoError(t, err)
+		names, err := s.StateStore.List()
+		require.NoError(t, err)
+		assert.Equal(t, []string{name}, names)
+	})
+}
@@ -1,27 +1,396 @@
 package master
 
 import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/codeuniversity/al-master/metrics"
 	"github.com/codeuniversity/al-proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 )
 
-//CISClientPool handles asynchronous access to clients
+//CISClient is a client of a cis slave, tagged with the address of the slave it belongs to
+type CISClient struct {
+	proto.CellInteractionServiceClient
+	Address string
+
+	conn   *grpc.ClientConn
+	health healthChecker
+	slave  *cisSlave
+}
+
+//healthChecker is the part of the grpc health client the pool needs
+type healthChecker interface {
+	Check(ctx context.Context, in *healthpb.HealthCheckRequest, opts ...grpc.CallOption) (*healthpb.HealthCheckResponse, error)
+}
+
+//NewCISClient dials the cis slave at address
+func NewCISClient(address string) (*CISClient, error) {
+	conn, err := grpc.Dial(address, grpc.WithInsecure())
+	if err != nil {
+		return nil, err
+	}
+	return &CISClient{
+		CellInteractionServiceClient: proto.NewCellInteractionServiceClient(conn),
+		Address:                      address,
+		conn:                         conn,
+		health:                       healthpb.NewHealthClient(conn),
+	}, nil
+}
+
+func (c *CISClient) close() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+//cisSlave keeps track of the clients and the health of one cis instance
+type cisSlave struct {
+	address     string
+	clientCount int
+	inUse       int
+	healthy     bool
+	removed     bool
+	health      healthChecker
+	//evictions in a row without a successful call in between, to back off re-admissions without health checks
+	evictions int
+
+	//clients of an evicted slave are parked here until it recovers
+	parkedClients []*CISClient
+	//drained is closed once a removed slave has no calls inflight anymore
+	drained chan struct{}
+}
+
+//CISClientPool handles asynchronous access to clients.
+//Slaves that fail calls or health checks get evicted and are re-admitted once they pass a health check again.
+//Without health checks, evicted slaves are re-admitted after a backoff
 type CISClientPool struct {
-	clientChan chan proto.CellInteractionServiceClient
+	clientChan chan *CISClient
+
+	slaves    map[string]*cisSlave
+	slaveLock *sync.Mutex
+
+	//healthWatched if WatchHealth re-admits evicted slaves
+	healthWatched bool
+	//readmitBackoff of the first re-admission without health checks, doubling with every eviction in a row
+	readmitBackoff    time.Duration
+	maxReadmitBackoff time.Duration
 }
 
 //NewCISClientPool returns a ClientPool that is capable of holding poolBufferSize-clients
 func NewCISClientPool(poolBufferSize int) *CISClientPool {
 	return &CISClientPool{
-		clientChan: make(chan proto.CellInteractionServiceClient, poolBufferSize),
+		clientChan:        make(chan *CISClient, poolBufferSize),
+		slaves:            map[string]*cisSlave{},
+		slaveLock:         &sync.Mutex{},
+		readmitBackoff:    time.Second,
+		maxReadmitBackoff: 30 * time.Second,
+	}
+}
+
+//AddClient registers a new client with the pool, creating the slave entry for its address if needed
+func (p *CISClientPool) AddClient(client *CISClient) {
+	p.slaveLock.Lock()
+	slave, ok := p.slaves[client.Address]
+	if !ok {
+		slave = &cisSlave{address: client.Address, healthy: true, health: client.health}
+		p.slaves[client.Address] = slave
+	}
+	slave.clientCount++
+	client.slave = slave
+	p.updateClientCountMetric()
+	p.slaveLock.Unlock()
+
+	p.putClient(client)
+}
+
+//GetClient from buffered clientChan, waiting until one is free or ctx is done.
+//Clients of evicted slaves are parked instead of being handed out
+func (p *CISClientPool) GetClient(ctx context.Context) (*CISClient, error) {
+	for {
+		select {
+		case client := <-p.clientChan:
+			if p.takeClient(client) {
+				return client, nil
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
 	}
 }
 
-//AddClient to buffered clientChan
-func (p *CISClientPool) AddClient(client proto.CellInteractionServiceClient) {
+//ReturnClient that was taken from the pool with GetClient, e.g. after a call that failed without being the fault of the slave
+func (p *CISClientPool) ReturnClient(client *CISClient) {
+	p.releaseClient(client)
+	p.putClient(client)
+}
+
+//ReportSuccess of a call made with client and return it to the pool. Only a successful call resets the eviction backoff of its slave
+func (p *CISClientPool) ReportSuccess(client *CISClient) {
+	p.slaveLock.Lock()
+	client.slave.evictions = 0
+	p.slaveLock.Unlock()
+
+	p.ReturnClient(client)
+}
+
+//ReportFailure of a call made with client. The slave of the client gets evicted until it passes a health check,
+//or until its re-admission backoff is over if health checks are disabled
+func (p *CISClientPool) ReportFailure(client *CISClient) {
+	p.slaveLock.Lock()
+	p.evict(client.slave)
+	p.slaveLock.Unlock()
+
+	p.releaseClient(client)
+	p.putClient(client)
+}
+
+//RemoveSlave and all of its clients from the pool. Idle clients are closed right away,
+//the returned channel is closed once all calls that are inflight on the slave have finished.
+//ok is false if no slave with that address is registered
+func (p *CISClientPool) RemoveSlave(address string) (drained <-chan struct{}, ok bool) {
+	p.slaveLock.Lock()
+	slave, ok := p.slaves[address]
+	if !ok {
+		p.slaveLock.Unlock()
+		return nil, false
+	}
+	delete(p.slaves, address)
+	slave.removed = true
+	slave.drained = make(chan struct{})
+	for _, client := range slave.parkedClients {
+		p.discard(client)
+	}
+	slave.parkedClients = nil
+	p.closeDrainedIfDone(slave)
+	p.updateClientCountMetric()
+	p.slaveLock.Unlock()
+
+	p.purgeIdleClients()
+	return slave.drained, true
+}
+
+//WatchHealth checks the health of every slave each interval until done is closed.
+//A non-positive interval disables health checks, evicted slaves are then re-admitted after a backoff
+func (p *CISClientPool) WatchHealth(interval time.Duration, done <-chan struct{}) {
+	if interval <= 0 {
+		return
+	}
+	p.slaveLock.Lock()
+	p.healthWatched = true
+	p.slaveLock.Unlock()
+	defer func() {
+		p.slaveLock.Lock()
+		p.healthWatched = false
+		p.slaveLock.Unlock()
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.CheckHealth(interval)
+		case <-done:
+			return
+		}
+	}
+}
+
+//CheckHealth of all slaves once, evicting failing ones and re-admitting recovered ones
+func (p *CISClientPool) CheckHealth(timeout time.Duration) {
+	p.slaveLock.Lock()
+	slaves := make([]*cisSlave, 0, len(p.slaves))
+	for _, slave := range p.slaves {
+		slaves = append(slaves, slave)
+	}
+	p.slaveLock.Unlock()
+
+	for _, slave := range slaves {
+		healthy := slaveHealthy(slave, timeout)
+
+		p.slaveLock.Lock()
+		clientsToReadmit := []*CISClient{}
+		if healthy && !slave.healthy && !slave.removed {
+			clientsToReadmit = p.readmit(slave)
+		} else if !healthy {
+			p.evict(slave)
+		}
+		p.slaveLock.Unlock()
+
+		for _, client := range clientsToReadmit {
+			p.clientChan <- client
+		}
+	}
+}
+
+//HealthySlaveCount is the amount of slaves that are currently admitted
+func (p *CISClientPool) HealthySlaveCount() int {
+	p.slaveLock.Lock()
+	defer p.slaveLock.Unlock()
+
+	count := 0
+	for _, slave := range p.slaves {
+		if slave.healthy {
+			count++
+		}
+	}
+	return count
+}
+
+//takeClient returns true if the client may be handed out, parking or discarding it otherwise
+func (p *CISClientPool) takeClient(client *CISClient) bool {
+	p.slaveLock.Lock()
+	defer p.slaveLock.Unlock()
+
+	slave := client.slave
+	switch {
+	case slave.removed:
+		p.discard(client)
+		return false
+	case !slave.healthy:
+		slave.parkedClients = append(slave.parkedClients, client)
+		return false
+	}
+	slave.inUse++
+	return true
+}
+
+func (p *CISClientPool) releaseClient(client *CISClient) {
+	p.slaveLock.Lock()
+	defer p.slaveLock.Unlock()
+
+	client.slave.inUse--
+	p.closeDrainedIfDone(client.slave)
+}
+
+//putClient back into the clientChan if its slave is admitted
+func (p *CISClientPool) putClient(client *CISClient) {
+	p.slaveLock.Lock()
+	slave := client.slave
+	switch {
+	case slave.removed:
+		p.discard(client)
+		p.slaveLock.Unlock()
+		return
+	case !slave.healthy:
+		slave.parkedClients = append(slave.parkedClients, client)
+		p.slaveLock.Unlock()
+		return
+	}
+	p.slaveLock.Unlock()
+
 	p.clientChan <- client
 }
 
-//GetClient from buffered clientChan
-func (p *CISClientPool) GetClient() proto.CellInteractionServiceClient {
-	return <-p.clientChan
+//purgeIdleClients of removed slaves that are waiting in the clientChan
+func (p *CISClientPool) purgeIdleClients() {
+	for i := len(p.clientChan); i > 0; i-- {
+		select {
+		case client := <-p.clientChan:
+			p.putClient(client)
+		default:
+			return
+		}
+	}
+}
+
+//discard expects the slaveLock to be held
+func (p *CISClientPool) discard(client *CISClient) {
+	client.close()
+	client.slave.clientCount--
+}
+
+//closeDrainedIfDone expects the slaveLock to be held
+func (p *CISClientPool) closeDrainedIfDone(slave *cisSlave) {
+	if slave.removed && slave.inUse == 0 {
+		select {
+		case <-slave.drained:
+		default:
+			close(slave.drained)
+		}
+	}
+}
+
+//evict expects the slaveLock to be held
+func (p *CISClientPool) evict(slave *cisSlave) {
+	if !slave.healthy {
+		return
+	}
+	slave.healthy = false
+	slave.evictions++
+	metrics.CISSlaveEvictionCounter.Inc()
+	p.updateClientCountMetric()
+	if !p.healthWatched {
+		time.AfterFunc(p.readmitBackoffFor(slave.evictions), func() {
+			p.readmitAfterBackoff(slave)
+		})
+	}
+}
+
+//readmitBackoffFor the given amount of evictions in a row
+func (p *CISClientPool) readmitBackoffFor(evictions int) time.Duration {
+	backoff := p.readmitBackoff
+	for i := 1; i < evictions && backoff < p.maxReadmitBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.maxReadmitBackoff {
+		return p.maxReadmitBackoff
+	}
+	return backoff
+}
+
+//readmitAfterBackoff unless the slave got re-admitted or removed in the meantime
+func (p *CISClientPool) readmitAfterBackoff(slave *cisSlave) {
+	p.slaveLock.Lock()
+	if slave.healthy || slave.removed {
+		p.slaveLock.Unlock()
+		return
+	}
+	clients := p.readmit(slave)
+	p.slaveLock.Unlock()
+
+	for _, client := range clients {
+		p.clientChan <- client
+	}
+}
+
+//readmit expects the slaveLock to be held and returns the clients that have to be put back into the pool
+func (p *CISClientPool) readmit(slave *cisSlave) []*CISClient {
+	slave.healthy = true
+	clients := slave.parkedClients
+	slave.parkedClients = nil
+	p.updateClientCountMetric()
+	return clients
+}
+
+//updateClientCountMetric expects the slaveLock to be held
+func (p *CISClientPool) updateClientCountMetric() {
+	count := 0
+	for _, slave := range p.slaves {
+		if slave.healthy {
+			count += slave.clientCount
+		}
+	}
+	metrics.CISClientCount.Set(float64(count))
+}
+
+//slaveHealthy asks the grpc health service of the slave.
+//Slaves that don't implement the health service count as healthy as long as they are reachable
+func slaveHealthy(slave *cisSlave, timeout time.Duration) bool {
+	if slave.health == nil {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	response, err := slave.health.Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		return status.Code(err) == codes.Unimplemented
+	}
+	return response.Status == healthpb.HealthCheckResponse_SERVING
 }
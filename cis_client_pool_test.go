@@ -0,0 +1,167 @@
+package master
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+type fakeHealthChecker struct {
+	err error
+}
+
+func (f *fakeHealthChecker) Check(ctx context.Context, in *healthpb.HealthCheckRequest, opts ...grpc.CallOption) (*healthpb.HealthCheckResponse, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+func getClientWithin(pool *CISClientPool, timeout time.Duration) *CISClient {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	client, _ := pool.GetClient(ctx)
+	return client
+}
+
+func TestCISClientPool(t *testing.T) {
+	t.Run("failing slaves get evicted and re-admitted after a successful health check", func(t *testing.T) {
+		health := &fakeHealthChecker{}
+		pool := NewCISClientPool(10)
+		flapping := &CISClient{Address: "flapping:3000", health: health}
+		pool.AddClient(flapping)
+
+		client := getClientWithin(pool, time.Second)
+		assert.Equal(t, flapping, client)
+		pool.ReportFailure(client)
+		assert.Equal(t, 0, pool.HealthySlaveCount())
+		assert.Len(t, pool.clientChan, 0)
+
+		pool.CheckHealth(time.Second)
+		assert.Equal(t, 1, pool.HealthySlaveCount())
+		assert.Equal(t, flapping, getClientWithin(pool, time.Second))
+	})
+
+	t.Run("without health checks evicted slaves are re-admitted after a backoff", func(t *testing.T) {
+		pool := NewCISClientPool(10)
+		pool.readmitBackoff = 10 * time.Millisecond
+		flapping := &CISClient{Address: "flapping:3000"}
+		pool.AddClient(flapping)
+
+		pool.ReportFailure(getClientWithin(pool, time.Second))
+		assert.Equal(t, 0, pool.HealthySlaveCount())
+		assert.Equal(t, flapping, getClientWithin(pool, time.Second))
+		assert.Equal(t, 1, pool.HealthySlaveCount())
+
+		assert.Equal(t, 10*time.Millisecond, pool.readmitBackoffFor(1))
+		assert.Equal(t, 40*time.Millisecond, pool.readmitBackoffFor(3))
+		assert.Equal(t, pool.maxReadmitBackoff, pool.readmitBackoffFor(100))
+	})
+
+	t.Run("clients of evicted slaves waiting in the pool are not handed out", func(t *testing.T) {
+		health := &fakeHealthChecker{}
+		pool := NewCISClientPool(10)
+		dead := &CISClient{Address: "dead:3000", health: health}
+		alive := &CISClient{Address: "alive:3000"}
+		pool.AddClient(dead)
+		pool.AddClient(alive)
+
+		health.err = errors.New("connection refused")
+		pool.CheckHealth(time.Second)
+
+		assert.Equal(t, 1, pool.HealthySlaveCount())
+		assert.Equal(t, alive, getClientWithin(pool, time.Second))
+	})
+
+	t.Run("slaves without a health service count as healthy", func(t *testing.T) {
+		health := &fakeHealthChecker{err: status.Error(codes.Unimplemented, "unknown service")}
+		pool := NewCISClientPool(10)
+		pool.AddClient(&CISClient{Address: "cis:3000", health: health})
+
+		pool.CheckHealth(time.Second)
+		assert.Equal(t, 1, pool.HealthySlaveCount())
+	})
+
+	t.Run("removing a slave waits for its inflight calls and drops its idle clients", func(t *testing.T) {
+		pool := NewCISClientPool(10)
+		leaving := &CISClient{Address: "leaving:3000"}
+		idle := &CISClient{Address: "leaving:3000"}
+		staying := &CISClient{Address: "staying:3000"}
+		pool.AddClient(leaving)
+		inflight := getClientWithin(pool, time.Second)
+		assert.Equal(t, leaving, inflight)
+		pool.AddClient(idle)
+		pool.AddClient(staying)
+
+		drained, ok := pool.RemoveSlave("leaving:3000")
+		assert.True(t, ok)
+		assert.Equal(t, 1, pool.HealthySlaveCount())
+		assert.Len(t, pool.clientChan, 1)
+
+		select {
+		case <-drained:
+			t.Fatal("slave was drained while a call was still inflight")
+		default:
+		}
+
+		pool.ReturnClient(inflight)
+		select {
+		case <-drained:
+		case <-time.After(time.Second):
+			t.Fatal("slave wasn't drained after its inflight call finished")
+		}
+		assert.Equal(t, staying, getClientWithin(pool, time.Second))
+	})
+
+	t.Run("getting a client gives up once the context is done", func(t *testing.T) {
+		pool := NewCISClientPool(10)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		client, err := pool.GetClient(ctx)
+		assert.Nil(t, client)
+		assert.Equal(t, context.DeadlineExceeded, err)
+	})
+
+	t.Run("removing an unknown slave fails", func(t *testing.T) {
+		pool := NewCISClientPool(10)
+		_, ok := pool.RemoveSlave("unknown:3000")
+		assert.False(t, ok)
+	})
+}
+
+func TestIsSlaveFailure(t *testing.T) {
+	running := context.Background()
+	assert.True(t, isSlaveFailure(running, status.Error(codes.Unavailable, "connection refused")))
+	assert.True(t, isSlaveFailure(running, errors.New("broken")))
+	assert.True(t, isSlaveFailure(running, context.DeadlineExceeded))
+	assert.True(t, isSlaveFailure(running, status.Error(codes.DeadlineExceeded, "context deadline exceeded")))
+
+	shutDown, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.True(t, isSlaveFailure(shutDown, status.Error(codes.Unavailable, "connection refused")))
+	assert.False(t, isSlaveFailure(shutDown, context.Canceled))
+	assert.False(t, isSlaveFailure(shutDown, context.DeadlineExceeded))
+	assert.False(t, isSlaveFailure(shutDown, status.Error(codes.Canceled, "context canceled")))
+	assert.False(t, isSlaveFailure(shutDown, status.Error(codes.DeadlineExceeded, "context deadline exceeded")))
+}
+
+func TestEvictionBackoffIsOnlyResetBySuccessfulCalls(t *testing.T) {
+	pool := NewCISClientPool(10)
+	pool.readmitBackoff = time.Millisecond
+	pool.AddClient(&CISClient{Address: "hanging:3000"})
+
+	pool.ReportFailure(getClientWithin(pool, time.Second))
+	pool.ReturnClient(getClientWithin(pool, time.Second))
+	assert.Equal(t, 1, pool.slaves["hanging:3000"].evictions)
+
+	pool.ReportSuccess(getClientWithin(pool, time.Second))
+	assert.Equal(t, 0, pool.slaves["hanging:3000"].evictions)
+}
@@ -0,0 +1,326 @@
+package master
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/codeuniversity/al-master/metrics"
+)
+
+const (
+	controlStateRunning = "running"
+	controlStatePaused  = "paused"
+	controlStateStopped = "stopped"
+)
+
+//ControlStatus is the answer to every control api call
+type ControlStatus struct {
+	State     string `json:"state"`
+	TimeStep  uint64 `json:"time_step"`
+	CellCount int    `json:"cell_count"`
+	//TargetStepsPerSecond is 0 if the simulation runs as fast as possible
+	TargetStepsPerSecond float64 `json:"target_steps_per_second"`
+	//ActualStepsPerSecond over the last steps
+	ActualStepsPerSecond float64 `json:"actual_steps_per_second"`
+	//StepsRemaining of the last step request
+	StepsRemaining uint64 `json:"steps_remaining"`
+	//Snapshot is the name of the state saved by a snapshot request
+	Snapshot string `json:"snapshot,omitempty"`
+}
+
+//controlCommand is sent by the control api to the Run loop, which executes it between two steps
+type controlCommand struct {
+	action string
+	steps  uint64
+	rate   float64
+	reply  chan *controlReply
+}
+
+type controlReply struct {
+	status *ControlStatus
+	err    error
+}
+
+//runControl is only touched by the goroutine executing Run
+type runControl struct {
+	paused  bool
+	stopped bool
+	//stepsRemaining before the simulation is paused again, 0 if no step request is pending
+	stepsRemaining uint64
+	stepWaiters    []*controlCommand
+
+	targetStepsPerSecond float64
+	lastStepStartedAt    time.Time
+	//stepFinishTimes of the last steps, to measure the actual tick rate
+	stepFinishTimes []time.Time
+	//failedStepsInARow since the last finished step, the retries of a failing step are backed off by them
+	failedStepsInARow int
+	retryAt           time.Time
+}
+
+//tickRateWindow is the amount of steps the actual tick rate is measured over
+const tickRateWindow = 10
+
+//MinTickRate is the lowest target tick rate above 0, lower rates would wait for longer than time.Duration can hold
+const MinTickRate = 0.001
+
+//ValidateTickRate so that it can be used as target tick rate, 0 means unlimited
+func ValidateTickRate(stepsPerSecond float64) error {
+	if math.IsNaN(stepsPerSecond) || math.IsInf(stepsPerSecond, 0) {
+		return errors.New("tick rate has to be a finite number")
+	}
+	if stepsPerSecond != 0 && stepsPerSecond < MinTickRate {
+		return fmt.Errorf("tick rate has to be 0 for unlimited or at least %v steps per second", MinTickRate)
+	}
+	return nil
+}
+
+func newRunControl(targetStepsPerSecond float64) *runControl {
+	c := &runControl{}
+	c.setTargetTickRate(targetStepsPerSecond)
+	return c
+}
+
+func (c *runControl) setTargetTickRate(stepsPerSecond float64) {
+	c.targetStepsPerSecond = stepsPerSecond
+	metrics.TargetTickRate.Set(stepsPerSecond)
+}
+
+//recordStepFinished at now and update the actual tick rate
+func (c *runControl) recordStepFinished(now time.Time) {
+	c.failedStepsInARow = 0
+	c.retryAt = time.Time{}
+	c.stepFinishTimes = append(c.stepFinishTimes, now)
+	if len(c.stepFinishTimes) > tickRateWindow {
+		c.stepFinishTimes = c.stepFinishTimes[1:]
+	}
+	metrics.ActualTickRate.Set(c.actualTickRate())
+}
+
+//recordStepFailed at now and hold off its retry by the backoff of the policy for the failed steps in a row, which is returned
+func (c *runControl) recordStepFailed(now time.Time, policy RetryPolicy) time.Duration {
+	c.failedStepsInARow++
+	backoff := policy.Backoff(c.failedStepsInARow)
+	c.retryAt = now.Add(backoff)
+	return backoff
+}
+
+//resetTickRate while no steps are made
+func (c *runControl) resetTickRate() {
+	c.stepFinishTimes = nil
+	metrics.ActualTickRate.Set(0)
+}
+
+//actualTickRate over the steps of the window, 0 until two steps finished
+func (c *runControl) actualTickRate() float64 {
+	if len(c.stepFinishTimes) < 2 {
+		return 0
+	}
+	elapsed := c.stepFinishTimes[len(c.stepFinishTimes)-1].Sub(c.stepFinishTimes[0])
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(len(c.stepFinishTimes)-1) / elapsed.Seconds()
+}
+
+func (c *runControl) canStep() bool {
+	return !c.stopped && (!c.paused || c.stepsRemaining > 0)
+}
+
+//nextStepAt is the earliest time the next step may start to keep the target rate and back off the retry of a failed step
+func (c *runControl) nextStepAt() time.Time {
+	next := c.lastStepStartedAt
+	if c.targetStepsPerSecond > 0 {
+		next = next.Add(time.Duration(float64(time.Second) / c.targetStepsPerSecond))
+	}
+	if c.retryAt.After(next) {
+		return c.retryAt
+	}
+	return next
+}
+
+//awaitStep handles control commands until the next step may start.
+//Returns the signal if one is received in the meantime
+func (s *Server) awaitStep(signals <-chan os.Signal) os.Signal {
+	for {
+		var timer *time.Timer
+		var stepAllowed <-chan time.Time
+		if s.control.canStep() {
+			wait := time.Until(s.control.nextStepAt())
+			if wait <= 0 {
+				select {
+				case command := <-s.controlCommands:
+					s.handleControlCommand(command)
+					continue
+				case signal := <-signals:
+					return signal
+				default:
+					s.control.lastStepStartedAt = time.Now()
+					return nil
+				}
+			}
+			timer = time.NewTimer(wait)
+			stepAllowed = timer.C
+		}
+
+		var signal os.Signal
+		select {
+		case command := <-s.controlCommands:
+			s.handleControlCommand(command)
+		case signal = <-signals:
+		case <-stepAllowed:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if signal != nil {
+			return signal
+		}
+	}
+}
+
+//stepFinished records the tick rate and pauses the simulation again once all requested steps are done
+func (s *Server) stepFinished() {
+	s.control.recordStepFinished(time.Now())
+	if s.control.stepsRemaining == 0 {
+		return
+	}
+	s.control.stepsRemaining--
+	if s.control.stepsRemaining == 0 {
+		s.replyToStepWaiters()
+		s.control.resetTickRate()
+	}
+}
+
+func (s *Server) handleControlCommand(command *controlCommand) {
+	var err error
+	status := &ControlStatus{}
+	if s.control.stopped && command.action != "status" && command.action != "snapshot" {
+		command.reply <- &controlReply{err: errors.New("the simulation is stopped")}
+		return
+	}
+
+	switch command.action {
+	case "pause":
+		s.control.paused = true
+		s.control.stepsRemaining = 0
+		s.replyToStepWaiters()
+		s.control.resetTickRate()
+	case "resume":
+		s.control.paused = false
+		s.control.stepsRemaining = 0
+		s.replyToStepWaiters()
+	case "step":
+		s.control.paused = true
+		s.control.stepsRemaining += command.steps
+		s.control.stepWaiters = append(s.control.stepWaiters, command)
+		return
+	case "rate":
+		s.control.setTargetTickRate(command.rate)
+	case "snapshot":
+		status.Snapshot, err = s.checkpoint()
+	case "stop":
+		s.control.stopped = true
+		s.control.stepsRemaining = 0
+		s.replyToStepWaiters()
+		s.control.resetTickRate()
+	}
+	if err != nil {
+		command.reply <- &controlReply{err: err}
+		return
+	}
+	command.reply <- &controlReply{status: s.controlStatus(status)}
+}
+
+func (s *Server) replyToStepWaiters() {
+	for _, waiter := range s.control.stepWaiters {
+		waiter.reply <- &controlReply{status: s.controlStatus(&ControlStatus{})}
+	}
+	s.control.stepWaiters = nil
+}
+
+func (s *Server) controlStatus(status *ControlStatus) *ControlStatus {
+	status.State = controlStateRunning
+	if s.control.stopped {
+		status.State = controlStateStopped
+	} else if s.control.paused {
+		status.State = controlStatePaused
+	}
+	status.TimeStep = s.TimeStep
+	status.CellCount = len(s.CellBuckets.AllCells())
+	status.TargetStepsPerSecond = s.control.targetStepsPerSecond
+	status.ActualStepsPerSecond = s.control.actualTickRate()
+	status.StepsRemaining = s.control.stepsRemaining
+	return status
+}
+
+func (s *Server) initControlAPI() {
+	s.httpMux.HandleFunc("/control/status", s.controlHandler("status", http.MethodGet))
+	s.httpMux.HandleFunc("/control/pause", s.controlHandler("pause", http.MethodPost))
+	s.httpMux.HandleFunc("/control/resume", s.controlHandler("resume", http.MethodPost))
+	s.httpMux.HandleFunc("/control/step", s.controlHandler("step", http.MethodPost))
+	s.httpMux.HandleFunc("/control/rate", s.controlHandler("rate", http.MethodPost))
+	s.httpMux.HandleFunc("/control/snapshot", s.controlHandler("snapshot", http.MethodPost))
+	s.httpMux.HandleFunc("/control/stop", s.controlHandler("stop", http.MethodPost))
+}
+
+//controlHandler passes the request as command to the Run loop and answers with the resulting ControlStatus
+func (s *Server) controlHandler(action, method string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, fmt.Sprintf("use %v", method), http.StatusMethodNotAllowed)
+			return
+		}
+		command := &controlCommand{action: action, reply: make(chan *controlReply, 1)}
+		switch action {
+		case "step":
+			steps, err := strconv.ParseUint(queryValueOr(r, "n", "1"), 10, 64)
+			if err != nil || steps == 0 {
+				http.Error(w, "n has to be a positive number of steps", http.StatusBadRequest)
+				return
+			}
+			command.steps = steps
+		case "rate":
+			rate, err := strconv.ParseFloat(r.URL.Query().Get("steps_per_second"), 64)
+			if err != nil {
+				http.Error(w, "steps_per_second has to be a number >= 0, 0 means unlimited", http.StatusBadRequest)
+				return
+			}
+			if err := ValidateTickRate(rate); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			command.rate = rate
+		}
+
+		select {
+		case s.controlCommands <- command:
+		case <-r.Context().Done():
+			return
+		}
+		select {
+		case reply := <-command.reply:
+			if reply.err != nil {
+				http.Error(w, reply.err.Error(), http.StatusConflict)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(reply.status)
+		case <-r.Context().Done():
+		}
+	}
+}
+
+func queryValueOr(r *http.Request, key, defaultValue string) string {
+	if value := r.URL.Query().Get(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
@@ -0,0 +1,134 @@
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func controlRequest(t *testing.T, s *Server, method, path string) (*ControlStatus, int) {
+	request, err := http.NewRequest(method, fmt.Sprintf("http://%v%v", s.HTTPAddr(), path), nil)
+	require.NoError(t, err)
+	client := &http.Client{Timeout: stepDeadlockTimeout}
+	response, err := client.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, response.StatusCode
+	}
+	status := &ControlStatus{}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(status))
+	return status, response.StatusCode
+}
+
+func TestControlAPI(t *testing.T) {
+	defer cleanup()
+	slave := startFakeSlave(t, 0)
+	defer slave.grpcServer.Stop()
+
+	config := testServerConfig()
+	config.StatesDir = testStatesFolderName
+	s := startTestServer(t, config, slave)
+
+	runDone := make(chan struct{})
+	go func() {
+		s.Run()
+		close(runDone)
+	}()
+
+	status, _ := controlRequest(t, s, http.MethodPost, "/control/pause")
+	assert.Equal(t, controlStatePaused, status.State)
+	pausedAt := status.TimeStep
+
+	status, _ = controlRequest(t, s, http.MethodPost, "/control/step?n=3")
+	assert.Equal(t, controlStatePaused, status.State)
+	assert.Equal(t, pausedAt+3, status.TimeStep)
+	assert.Equal(t, 2000, status.CellCount)
+
+	time.Sleep(50 * time.Millisecond)
+	status, _ = controlRequest(t, s, http.MethodGet, "/control/status")
+	assert.Equal(t, pausedAt+3, status.TimeStep, "no steps are made while paused")
+
+	status, _ = controlRequest(t, s, http.MethodPost, "/control/rate?steps_per_second=5")
+	assert.Equal(t, 5.0, status.TargetStepsPerSecond)
+	status, _ = controlRequest(t, s, http.MethodPost, "/control/resume")
+	assert.Equal(t, controlStateRunning, status.State)
+	time.Sleep(300 * time.Millisecond)
+	status, _ = controlRequest(t, s, http.MethodPost, "/control/pause")
+	stepsWhileRunning := status.TimeStep - pausedAt - 3
+	assert.True(t, stepsWhileRunning <= 2, "%v steps within 300ms at 5 steps per second", stepsWhileRunning)
+
+	status, _ = controlRequest(t, s, http.MethodPost, "/control/snapshot")
+	require.NotEmpty(t, status.Snapshot)
+	saved, err := s.StateStore.Load(status.Snapshot)
+	require.NoError(t, err)
+	assert.Equal(t, status.TimeStep, saved.TimeStep)
+
+	status, _ = controlRequest(t, s, http.MethodPost, "/control/stop")
+	assert.Equal(t, controlStateStopped, status.State)
+	_, code := controlRequest(t, s, http.MethodPost, "/control/resume")
+	assert.Equal(t, http.StatusConflict, code)
+	_, code = controlRequest(t, s, http.MethodGet, "/control/pause")
+	assert.Equal(t, http.StatusMethodNotAllowed, code)
+	_, code = controlRequest(t, s, http.MethodPost, "/control/step?n=0")
+	assert.Equal(t, http.StatusBadRequest, code)
+	for _, rate := range []string{"-1", "NaN", "Inf", "1e-300"} {
+		_, code = controlRequest(t, s, http.MethodPost, "/control/rate?steps_per_second="+rate)
+		assert.Equal(t, http.StatusBadRequest, code, "steps_per_second=%v", rate)
+	}
+
+	select {
+	case <-runDone:
+		t.Fatal("Run returned after stop")
+	default:
+	}
+	s.signals <- os.Signal(syscall.SIGTERM)
+	select {
+	case <-runDone:
+	case <-time.After(stepDeadlockTimeout):
+		t.Fatal("Run didn't return after a signal")
+	}
+}
+
+func TestTickRate(t *testing.T) {
+	c := newRunControl(4)
+	assert.Equal(t, 4.0, c.targetStepsPerSecond)
+	assert.Equal(t, c.lastStepStartedAt.Add(250*time.Millisecond), c.nextStepAt())
+
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		c.recordStepFinished(start.Add(time.Duration(i) * 500 * time.Millisecond))
+	}
+	assert.Len(t, c.stepFinishTimes, tickRateWindow)
+	assert.InDelta(t, 2.0, c.actualTickRate(), 0.001)
+
+	c.resetTickRate()
+	assert.Equal(t, 0.0, c.actualTickRate())
+
+	c.setTargetTickRate(0)
+	assert.Equal(t, c.lastStepStartedAt, c.nextStepAt(), "unlimited")
+}
+
+func TestStepRetryBackoff(t *testing.T) {
+	c := newRunControl(0)
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+	now := time.Now()
+
+	assert.Equal(t, 100*time.Millisecond, c.recordStepFailed(now, policy))
+	assert.Equal(t, now.Add(100*time.Millisecond), c.nextStepAt())
+	assert.Equal(t, 200*time.Millisecond, c.recordStepFailed(now, policy))
+	assert.Equal(t, 300*time.Millisecond, c.recordStepFailed(now, policy))
+	assert.Equal(t, 300*time.Millisecond, c.recordStepFailed(now, policy))
+
+	c.recordStepFinished(now)
+	assert.Equal(t, c.lastStepStartedAt, c.nextStepAt())
+	assert.Equal(t, 100*time.Millisecond, c.recordStepFailed(now, policy), "a finished step resets the backoff")
+}
@@ -0,0 +1,94 @@
+package filters
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/codeuniversity/al-proto"
+)
+
+//Evaluator decides which cells pass a filter, implemented by Set, Expression and RegionFilter
+type Evaluator interface {
+	Eval(cell *proto.Cell) (passes bool, warnings []string)
+}
+
+//RegionOf the evaluator, if it only lets cells within a Region pass
+func RegionOf(evaluator Evaluator) (Region, bool) {
+	if regionFilter, ok := evaluator.(*RegionFilter); ok {
+		return regionFilter.Region, true
+	}
+	return nil, false
+}
+
+//expressionMessage is the JSON object form of an expression and/or a region
+type expressionMessage struct {
+	Expression *string           `json:"expression"`
+	Region     *RegionDefinition `json:"region"`
+}
+
+//Parse a filter sent by a client, which is either
+//	a JSON array of FilterDefinitions, which all have to pass,
+//	a JSON object {"expression": "<expression>", "region": <RegionDefinition>} with one or both of the keys,
+//	a JSON string or plain text containing an expression. Only messages that are a JSON string as a whole are decoded as one.
+//An empty array returns a nil Evaluator
+func Parse(message []byte) (Evaluator, error) {
+	trimmed := bytes.TrimSpace(message)
+	if len(trimmed) == 0 {
+		return nil, errors.New("the filter is empty")
+	}
+
+	switch trimmed[0] {
+	case '[':
+		definitions := []*FilterDefinition{}
+		if err := json.Unmarshal(trimmed, &definitions); err != nil {
+			return nil, err
+		}
+		if len(definitions) == 0 {
+			return nil, nil
+		}
+		return SetFromDefinitions(definitions), nil
+	case '{':
+		decoded := &expressionMessage{}
+		if err := json.Unmarshal(trimmed, decoded); err != nil {
+			return nil, err
+		}
+		if decoded.Region != nil {
+			return compileRegionFilter(decoded)
+		}
+		if decoded.Expression == nil {
+			return nil, errors.New(`the filter object has neither "expression" nor "region"`)
+		}
+		return compileEvaluator(*decoded.Expression)
+	case '"':
+		//expressions can start with a string literal as well, like "abc" = cell.id
+		var expression string
+		if err := json.Unmarshal(trimmed, &expression); err == nil {
+			return compileEvaluator(expression)
+		}
+	}
+	return compileEvaluator(string(trimmed))
+}
+
+//compileEvaluator returns a nil Evaluator instead of a nil *Expression on errors
+func compileEvaluator(source string) (Evaluator, error) {
+	expression, err := CompileExpression(source)
+	if err != nil {
+		return nil, err
+	}
+	return expression, nil
+}
+
+func compileRegionFilter(decoded *expressionMessage) (Evaluator, error) {
+	region, err := NewRegion(decoded.Region)
+	if err != nil {
+		return nil, err
+	}
+	regionFilter := &RegionFilter{Region: region}
+	if decoded.Expression != nil {
+		if regionFilter.Filter, err = compileEvaluator(*decoded.Expression); err != nil {
+			return nil, err
+		}
+	}
+	return regionFilter, nil
+}
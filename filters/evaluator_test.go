@@ -0,0 +1,135 @@
+package filters
+
+import (
+	"testing"
+
+	"github.com/codeuniversity/al-proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	passing := &proto.Cell{Pos: &proto.Vector{X: 1}}
+	failing := &proto.Cell{Pos: &proto.Vector{X: 100}}
+
+	t.Run("all forms of filters", func(t *testing.T) {
+		for _, message := range []string{
+			`[{"left_hand": "cell.pos.x", "left_hand_type": "coordinate", "operator": "<", "right_hand": "42", "right_hand_type": "number"}]`,
+			`{"expression": "cell.pos.x < 42"}`,
+			`{"region": {"type": "box", "min": [0, 0, 0], "max": [42, 1, 1]}}`,
+			`{"region": {"type": "sphere", "center": [0, 0, 0], "radius": 1000}, "expression": "cell.pos.x < 42"}`,
+			`"cell.pos.x < 42"`,
+			"  cell.pos.x < 42\n",
+		} {
+			evaluator, err := Parse([]byte(message))
+			require.NoError(t, err, message)
+			passes, _ := evaluator.Eval(passing)
+			assert.True(t, passes, message)
+			passes, _ = evaluator.Eval(failing)
+			assert.False(t, passes, message)
+		}
+	})
+
+	t.Run("expressions starting with a string literal", func(t *testing.T) {
+		for _, message := range []string{`"abc" = cell.id`, `"\"abc\" = cell.id"`} {
+			evaluator, err := Parse([]byte(message))
+			require.NoError(t, err, message)
+			passes, _ := evaluator.Eval(&proto.Cell{Id: "abc"})
+			assert.True(t, passes, message)
+			passes, _ = evaluator.Eval(&proto.Cell{Id: "abd"})
+			assert.False(t, passes, message)
+		}
+	})
+
+	t.Run("legacy definitions stay a Set", func(t *testing.T) {
+		evaluator, err := Parse([]byte(`[{"left_hand": "cell.pos.x", "left_hand_type": "coordinate", "operator": "<=", "right_hand": "1", "right_hand_type": "number"}]`))
+		require.NoError(t, err)
+		require.IsType(t, Set{}, evaluator)
+		passes, warnings := evaluator.Eval(passing)
+		assert.True(t, passes)
+		assert.Empty(t, warnings)
+	})
+
+	t.Run("region filters expose their region", func(t *testing.T) {
+		evaluator, err := Parse([]byte(`{"region": {"type": "sphere", "center": [1, 0, 0], "radius": 2}}`))
+		require.NoError(t, err)
+		region, ok := RegionOf(evaluator)
+		require.True(t, ok)
+		assert.Equal(t, &Sphere{Center: Point{1, 0, 0}, Radius: 2}, region)
+
+		expression, err := Parse([]byte(`cell.pos.x < 42`))
+		require.NoError(t, err)
+		_, ok = RegionOf(expression)
+		assert.False(t, ok)
+	})
+
+	t.Run("an empty array is no filter", func(t *testing.T) {
+		evaluator, err := Parse([]byte(`[]`))
+		assert.NoError(t, err)
+		assert.Nil(t, evaluator)
+	})
+
+	t.Run("invalid filters", func(t *testing.T) {
+		for _, message := range []string{
+			``,
+			`[{"left_hand": 1}]`,
+			`{"filter": "cell.pos.x < 42"}`,
+			`{"expression": "cell.pos.x <"}`,
+			`{"region": {"type": "cube"}}`,
+			`{"region": {"type": "box", "min": [1, 0, 0], "max": [0, 0, 0]}}`,
+			`{"region": {"type": "box", "min": [0, 0, 0], "max": [1, 1, 1]}, "expression": "cell.pos.x <"}`,
+			`"cell.pos.x < 42`,
+			`cell.pos.x <`,
+		} {
+			evaluator, err := Parse([]byte(message))
+			assert.Error(t, err, message)
+			assert.Nil(t, evaluator, message)
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	evaluator, validationErr := Validate([]byte(`{"expression": "cell.energy > 1"}`))
+	assert.Nil(t, validationErr)
+	assert.NotNil(t, evaluator)
+
+	evaluator, validationErr = Validate([]byte(`cell.energy >`))
+	assert.Nil(t, evaluator)
+	require.NotNil(t, validationErr)
+	require.NotNil(t, validationErr.Pos)
+	assert.Equal(t, 13, *validationErr.Pos)
+
+	evaluator, validationErr = Validate([]byte(`[
+		{"left_hand": "cell.energy", "left_hand_type": "field", "operator": ">", "right_hand": "1", "right_hand_type": "number"},
+		{"left_hand": "cell.id", "left_hand_type": "field", "operator": ">", "right_hand": "1", "right_hand_type": "number"},
+		{"left_hand": "cell.energy", "left_hand_type": "feld", "operator": "~", "right_hand": "1", "right_hand_type": "number"}
+	]`))
+	assert.Nil(t, evaluator)
+	require.NotNil(t, validationErr)
+	assert.Equal(t, "invalid filter definitions at index 1, 2", validationErr.Msg)
+	assert.Nil(t, validationErr.Pos)
+	assert.Equal(
+		t,
+		map[int][]string{
+			1: {"can't compare string with number"},
+			2: {"left hand {cell.energy feld} is invalid", "operator is invalid"},
+		},
+		validationErr.Definitions,
+	)
+
+	evaluator, validationErr = Validate([]byte(`[]`))
+	assert.Nil(t, evaluator)
+	assert.NotNil(t, validationErr)
+
+	evaluator, validationErr = Validate([]byte(`[{"left_hand": "cell.energy", "left_hand_type": "field", "operator": ">", "right_hand": "1", "right_hand_type": "number"}, null]`))
+	assert.Nil(t, evaluator)
+	require.NotNil(t, validationErr)
+	assert.Equal(t, "invalid filter definitions at index 1", validationErr.Msg)
+	assert.Equal(t, map[int][]string{1: {"definition is null"}}, validationErr.Definitions)
+
+	parsed, err := Parse([]byte(`[null]`))
+	require.NoError(t, err)
+	passes, warnings := parsed.Eval(&proto.Cell{})
+	assert.False(t, passes, "null definitions never pass")
+	assert.Equal(t, []string{"definition is null"}, warnings)
+}
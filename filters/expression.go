@@ -0,0 +1,445 @@
+package filters
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/codeuniversity/al-proto"
+)
+
+//Expression is a compiled boolean filter expression like
+//	(cell.pos.x < 500 or cell.energy > 10) and not cell.dying and cell.id != "a"
+//
+//Conditions compare two hands with <, >, <=, >=, = (or ==) and !=, check that a hand is within an inclusive range
+//or are a bool hand on their own. Both sides of a comparison need to have the same type, see Fields.
+//They are combined with and (&&), or (||) and not (!), in decreasing order of precedence: not, and, or.
+//
+//Hands can be calculated with +, -, *, / and the functions abs, sqrt, len, vec and dist, like
+//	dist(cell.pos, vec(0, 0, 0)) < 200 and cell.energy / len(cell.dna) > 2
+type Expression struct {
+	source string
+	root   node
+}
+
+//CompileExpression parses the expression once, so it can be evaluated for many cells
+func CompileExpression(source string) (*Expression, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{source: source, tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != tokenEOF {
+		return nil, &SyntaxError{Pos: next.pos, Msg: fmt.Sprintf("unexpected %v", next)}
+	}
+	return &Expression{source: source, root: root}, nil
+}
+
+//Eval the expression to see if the cell passes it.
+//Hands that can't be evaluated for the cell, like a division by zero, fail their condition with a warning
+func (e *Expression) Eval(cell *proto.Cell) (passes bool, warnings []string) {
+	passes = e.root.eval(cell, &warnings)
+	return
+}
+
+func (e *Expression) String() string {
+	return e.source
+}
+
+//node of the syntax tree of an Expression
+type node interface {
+	eval(cell *proto.Cell, warnings *[]string) bool
+}
+
+type orNode struct {
+	lft, rgt node
+}
+
+func (n *orNode) eval(cell *proto.Cell, warnings *[]string) bool {
+	return n.lft.eval(cell, warnings) || n.rgt.eval(cell, warnings)
+}
+
+type andNode struct {
+	lft, rgt node
+}
+
+func (n *andNode) eval(cell *proto.Cell, warnings *[]string) bool {
+	return n.lft.eval(cell, warnings) && n.rgt.eval(cell, warnings)
+}
+
+type notNode struct {
+	operand node
+}
+
+func (n *notNode) eval(cell *proto.Cell, warnings *[]string) bool {
+	return !n.operand.eval(cell, warnings)
+}
+
+//evalHands of a condition, false if any of them is invalid for the cell
+func evalHands(cell *proto.Cell, warnings *[]string, hands ...Var) ([]Var, bool) {
+	values := make([]Var, len(hands))
+	valid := true
+	for i, hand := range hands {
+		values[i] = hand.Eval(cell)
+		if !values[i].Valid() {
+			*warnings = append(*warnings, fmt.Sprintf("%v is invalid", values[i]))
+			valid = false
+		}
+	}
+	return values, valid
+}
+
+type comparisonNode struct {
+	lft, rgt Var
+	op       operator
+}
+
+func (n *comparisonNode) eval(cell *proto.Cell, warnings *[]string) bool {
+	values, valid := evalHands(cell, warnings, n.lft, n.rgt)
+	return valid && compare(n.op, values[0], values[1])
+}
+
+//boolNode passes if the bool hand is true
+type boolNode struct {
+	value Var
+}
+
+func (n *boolNode) eval(cell *proto.Cell, warnings *[]string) bool {
+	values, valid := evalHands(cell, warnings, n.value)
+	return valid && values[0].Equal(&boolVar{Value: true})
+}
+
+//rangeNode checks from <= value <= to
+type rangeNode struct {
+	value, from, to Var
+}
+
+func (n *rangeNode) eval(cell *proto.Cell, warnings *[]string) bool {
+	values, valid := evalHands(cell, warnings, n.value, n.from, n.to)
+	return valid &&
+		compare(operatorGreaterThanOrEqual, values[0], values[1]) &&
+		compare(operatorLessThanOrEqual, values[0], values[2])
+}
+
+//parser is a recursive descent parser of the grammar
+//	or         = and { "or" and }
+//	and        = not { "and" not }
+//	not        = "not" not | "(" or ")" | condition
+//	condition  = hand [ operator hand | "in" hand ".." hand ]
+//	hand       = term { ( "+" | "-" ) term }
+//	term       = factor { ( "*" | "/" ) factor }
+//	factor     = "-" factor | "(" hand ")" | number | string | "true" | "false" | field | function "(" [ hand { "," hand } ] ")"
+//
+//A parenthesis at the start of a condition is ambiguous, it is parsed as grouped conditions first and as hand otherwise
+type parser struct {
+	source string
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) expect(kind tokenKind, description string) (token, error) {
+	t := p.next()
+	if t.kind != kind {
+		return t, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("expected %v but got %v", description, t)}
+	}
+	return t, nil
+}
+
+func (p *parser) parseOr() (node, error) {
+	lft, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenOr {
+		p.next()
+		rgt, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		lft = &orNode{lft: lft, rgt: rgt}
+	}
+	return lft, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	lft, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenAnd {
+		p.next()
+		rgt, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		lft = &andNode{lft: lft, rgt: rgt}
+	}
+	return lft, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	switch p.peek().kind {
+	case tokenNot:
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &notNode{operand: operand}, nil
+	case tokenLeftParen:
+		start := p.pos
+		group, groupErr := p.parseGroup()
+		if groupErr == nil && !continuesHand(p.peek()) {
+			return group, nil
+		}
+		p.pos = start
+		condition, err := p.parseCondition()
+		if err != nil && groupErr != nil && errorPos(groupErr) >= errorPos(err) {
+			//report the error of the interpretation that got further
+			return nil, groupErr
+		}
+		return condition, err
+	}
+	return p.parseCondition()
+}
+
+//parseGroup of conditions in parentheses
+func (p *parser) parseGroup() (node, error) {
+	p.next()
+	inner, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(tokenRightParen, `")"`); err != nil {
+		return nil, err
+	}
+	return inner, nil
+}
+
+func errorPos(err error) int {
+	if syntaxErr, ok := err.(*SyntaxError); ok {
+		return syntaxErr.Pos
+	}
+	return 0
+}
+
+//continuesHand if the token can only follow a hand, so the parentheses before it belong to the hand
+func continuesHand(t token) bool {
+	switch t.kind {
+	case tokenArithmetic, tokenOperator, tokenIn:
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseCondition() (node, error) {
+	lft, err := p.parseHand()
+	if err != nil {
+		return nil, err
+	}
+
+	t := p.peek()
+	switch t.kind {
+	case tokenOperator:
+		p.next()
+		rgt, err := p.parseHand()
+		if err != nil {
+			return nil, err
+		}
+		op := parseOperator(t.text)
+		if err := checkComparison(op, lft.Type(), rgt.Type()); err != nil {
+			return nil, &SyntaxError{Pos: t.pos, Msg: err.Error()}
+		}
+		return &comparisonNode{lft: lft, rgt: rgt, op: op}, nil
+	case tokenIn:
+		p.next()
+		from, err := p.parseHand()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRange, `".."`); err != nil {
+			return nil, err
+		}
+		to, err := p.parseHand()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkRange(lft.Type(), from.Type(), to.Type()); err != nil {
+			return nil, &SyntaxError{Pos: t.pos, Msg: err.Error()}
+		}
+		return &rangeNode{value: lft, from: from, to: to}, nil
+	}
+	if lft.Type() == TypeBool {
+		return &boolNode{value: lft}, nil
+	}
+	p.next()
+	return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("expected a comparison operator or \"in\" but got %v", t)}
+}
+
+func (p *parser) parseHand() (Var, error) {
+	start := p.peek().pos
+	lft, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenArithmetic && (p.peek().text == "+" || p.peek().text == "-") {
+		t := p.next()
+		rgt, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		if lft, err = p.arithmetic(t, lft, rgt, start); err != nil {
+			return nil, err
+		}
+	}
+	return lft, nil
+}
+
+func (p *parser) parseTerm() (Var, error) {
+	start := p.peek().pos
+	lft, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokenArithmetic && (p.peek().text == "*" || p.peek().text == "/") {
+		t := p.next()
+		rgt, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		if lft, err = p.arithmetic(t, lft, rgt, start); err != nil {
+			return nil, err
+		}
+	}
+	return lft, nil
+}
+
+//arithmetic of two numbers, lft starts at the byte offset start
+func (p *parser) arithmetic(t token, lft, rgt Var, start int) (Var, error) {
+	if lft.Type() != TypeNumber || rgt.Type() != TypeNumber {
+		return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("can't apply %v to %v and %v", t.text, lft.Type(), rgt.Type())}
+	}
+	return &arithmeticVar{op: t.text[0], lft: lft, rgt: rgt, source: p.sourceSince(start)}, nil
+}
+
+//sourceSince the byte offset start up to the last consumed token
+func (p *parser) sourceSince(start int) string {
+	last := p.tokens[p.pos-1]
+	end := last.pos + len(last.text)
+	if last.kind == tokenString {
+		end += 2
+	}
+	return p.source[start:end]
+}
+
+func (p *parser) parseFactor() (Var, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenArithmetic:
+		if t.text != "-" {
+			break
+		}
+		operand, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return p.arithmetic(t, &numberVar{Value: 0}, operand, t.pos)
+	case tokenLeftParen:
+		inner, err := p.parseHand()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokenRightParen, `")"`); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	case tokenNumber:
+		return compileNumberVar(t.text), nil
+	case tokenString:
+		return &stringVar{Value: t.text}, nil
+	case tokenIdent:
+		switch strings.ToLower(t.text) {
+		case "true", "false":
+			return compileBoolVar(strings.ToLower(t.text)), nil
+		}
+		if p.peek().kind == tokenLeftParen {
+			return p.parseCall(t)
+		}
+		field := compileFieldVar(t.text)
+		if !field.Valid() {
+			return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unknown field %v", t.text)}
+		}
+		return field, nil
+	}
+	return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("expected a number, string, bool, field or function but got %v", t)}
+}
+
+//parseCall of the function named by t, whose arguments are in parentheses after it
+func (p *parser) parseCall(t token) (Var, error) {
+	p.next()
+	args := []Var{}
+	if p.peek().kind != tokenRightParen {
+		for {
+			arg, err := p.parseHand()
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			if p.peek().kind != tokenComma {
+				break
+			}
+			p.next()
+		}
+	}
+	if _, err := p.expect(tokenRightParen, `")"`); err != nil {
+		return nil, err
+	}
+	call, err := compileCall(t.text, args, p.sourceSince(t.pos))
+	if err != nil {
+		return nil, &SyntaxError{Pos: t.pos, Msg: err.Error()}
+	}
+	return call, nil
+}
+
+//compileHandExpression of a single hand like dist(cell.pos, vec(0, 0, 0)) / 2
+func compileHandExpression(source string) (Var, error) {
+	tokens, err := lex(source)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{source: source, tokens: tokens}
+	hand, err := p.parseHand()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != tokenEOF {
+		return nil, &SyntaxError{Pos: next.pos, Msg: fmt.Sprintf("unexpected %v", next)}
+	}
+	return hand, nil
+}
+
+//checkRange only allows numbers and strings, which all sides need to be of
+func checkRange(valueType, fromType, toType VarType) error {
+	if valueType != TypeNumber && valueType != TypeString {
+		return fmt.Errorf("can't check if a %v is in a range", valueType)
+	}
+	if fromType != valueType || toType != valueType {
+		return fmt.Errorf("the range of a %v needs to be from %v to %v", valueType, valueType, valueType)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package filters
+
+import (
+	"testing"
+
+	"github.com/codeuniversity/al-proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileExpression(t *testing.T) {
+	cell := &proto.Cell{Id: "b", EnergyLevel: 20, Pos: &proto.Vector{X: 100, Y: 20, Z: -5}, Dna: []byte("ACGT")}
+
+	t.Run("expressions evaluate as expected", func(t *testing.T) {
+		cases := map[string]bool{
+			"cell.pos.x < 500":                                          true,
+			"cell.pos.x <= 100":                                         true,
+			"cell.pos.x >= 101":                                         false,
+			"cell.pos.x != 100":                                         false,
+			"cell.pos.x == 100 && cell.pos.y = 20":                      true,
+			"cell.pos.x > 500 or cell.pos.y > 10":                       true,
+			"not cell.pos.x < 500":                                      false,
+			"!(cell.pos.x < 500) || cell.pos.z < 0":                     true,
+			"cell.pos.z in -10..10":                                     true,
+			"cell.pos.x in 0..99.5":                                     false,
+			"cell.pos.x in cell.pos.y..200":                             true,
+			"cell.pos.y in 20..20":                                      true,
+			"(cell.pos.x > 500 or cell.pos.y > 10) and cell.pos.z < 0":  true,
+			"cell.pos.x > 500 or cell.pos.y > 10 and cell.pos.z > 0":    false,
+			"NOT cell.pos.x > 500 AND cell.pos.y < 30":                  true,
+			"(cell.pos.x < 500 or cell.energy > 10) and not cell.dying": true,
+			"cell.dying":                                                false,
+			"cell.dying = false":                                        true,
+			"cell.id != 'a' and cell.id < \"c\"":                        true,
+			"cell.id in \"a\"..\"c\"":                                   true,
+			"cell.dna == \"ACGT\"":                                      true,
+			"cell.dna_length >= 4":                                      true,
+			"cell.vel.x = 0":                                            true,
+			"cell.connected or cell.connection_count > 0":               false,
+			"dist(cell.pos, vec(100, 20, 0)) = 5":                       true,
+			"cell.energy / len(cell.dna) > 2":                           true,
+			"cell.pos.x - cell.pos.y * 2 = 60":                          true,
+			"(cell.pos.x - cell.pos.y) * 2 = 160":                       true,
+			"((cell.pos.x + 1) > 100)":                                  true,
+			"-cell.pos.z = 5 and 2 - -3 = 5":                            true,
+			"abs(cell.pos.z) in 0..sqrt(25)":                            true,
+			"cell.pos.x-1 < 100":                                        true,
+			"cell.pos = vec(100, 20, -5) and cell.vel != vec(0, 0, 1)":  true,
+		}
+		for source, expected := range cases {
+			expression, err := CompileExpression(source)
+			require.NoError(t, err, source)
+			passes, warnings := expression.Eval(cell)
+			assert.Equal(t, expected, passes, source)
+			assert.Empty(t, warnings, source)
+			assert.Equal(t, source, expression.String())
+		}
+	})
+
+	t.Run("syntax errors point at the problem", func(t *testing.T) {
+		cases := map[string]int{
+			"":                          0,
+			"cell.pos.x <":              12,
+			"cell.pos.x < 5 and":        18,
+			"(cell.pos.x < 5":           15,
+			"cell.pos.x < 5)":           14,
+			"cell.pos.w < 5":            0,
+			"cell.pos.x ~ 5":            11,
+			"cell.pos.x in 1 5":         16,
+			"cell.pos.x 5":              11,
+			"cell.pos.x < 5 cell.pos.y": 15,
+			"cell.id < 5":               8,
+			"cell.dying < true":         11,
+			"cell.dying in 0..1":        11,
+			"cell.pos.x in 'a'..'b'":    11,
+			"cell.id = 'a":              10,
+			"cell.energy":               11,
+			"cell.id + 1 > 0":           8,
+			"sqrt(cell.id) > 1":         0,
+			"dist(cell.pos) > 1":        0,
+			"foo(1) > 1":                0,
+			"cell.pos < vec(1, 2, 3)":   9,
+			"len(cell.dna > 1":          13,
+			"(cell.energy + 1 > 0":      20,
+		}
+		for source, pos := range cases {
+			_, err := CompileExpression(source)
+			require.Error(t, err, source)
+			require.IsType(t, &SyntaxError{}, err, source)
+			assert.Equal(t, pos, err.(*SyntaxError).Pos, "%v: %v", source, err)
+		}
+	})
+}
+
+func TestExpressionWarnings(t *testing.T) {
+	cell := &proto.Cell{EnergyLevel: 20, Pos: &proto.Vector{X: 100, Y: 20, Z: -5}}
+
+	expression, err := CompileExpression("cell.energy / (cell.pos.y - 20) > 1")
+	require.NoError(t, err)
+	passes, warnings := expression.Eval(cell)
+	assert.False(t, passes)
+	assert.Equal(t, []string{"cell.energy / (cell.pos.y - 20) (division by zero) is invalid"}, warnings)
+
+	expression, err = CompileExpression("not sqrt(cell.pos.z) < 1")
+	require.NoError(t, err)
+	passes, warnings = expression.Eval(cell)
+	assert.True(t, passes, "the invalid condition fails, so its negation passes")
+	assert.Equal(t, []string{"sqrt(cell.pos.z) (square root of a negative number) is invalid"}, warnings)
+}
+
+func TestLex(t *testing.T) {
+	tokens, err := lex("cell.pos.x in -1.5..cell.pos.y")
+	require.NoError(t, err)
+	texts := []string{}
+	for _, token := range tokens {
+		texts = append(texts, token.text)
+	}
+	assert.Equal(t, []string{"cell.pos.x", "in", "-1.5", "..", "cell.pos.y", ""}, texts)
+	assert.Equal(t, tokenRange, tokens[3].kind)
+	assert.Equal(t, tokenEOF, tokens[5].kind)
+}
@@ -0,0 +1,119 @@
+package filters
+
+import (
+	"sort"
+
+	"github.com/codeuniversity/al-proto"
+)
+
+//Field describes a value of a cell filters can address by Name
+type Field struct {
+	Name        string  `json:"name"`
+	Type        VarType `json:"type"`
+	Description string  `json:"description"`
+}
+
+//fieldAccessor reads the value of a Field from a cell
+type fieldAccessor struct {
+	Field
+	get func(cell *proto.Cell) Var
+}
+
+//fieldRegistry maps the names of all fields to their accessors
+var fieldRegistry = map[string]*fieldAccessor{}
+
+func registerField(name string, varType VarType, description string, get func(cell *proto.Cell) Var) {
+	fieldRegistry[name] = &fieldAccessor{
+		Field: Field{Name: name, Type: varType, Description: description},
+		get:   get,
+	}
+}
+
+func numberField(name, description string, get func(cell *proto.Cell) float64) {
+	registerField(name, TypeNumber, description, func(cell *proto.Cell) Var {
+		return &numberVar{Value: get(cell)}
+	})
+}
+
+func stringField(name, description string, get func(cell *proto.Cell) string) {
+	registerField(name, TypeString, description, func(cell *proto.Cell) Var {
+		return &stringVar{Value: get(cell)}
+	})
+}
+
+func boolField(name, description string, get func(cell *proto.Cell) bool) {
+	registerField(name, TypeBool, description, func(cell *proto.Cell) Var {
+		return &boolVar{Value: get(cell)}
+	})
+}
+
+//vectorFields registers a vector of the cell and its x, y and z fields, a nil vector is treated as zero vector
+func vectorFields(name, description string, get func(cell *proto.Cell) *proto.Vector) {
+	registerField(name, TypeVector, description, func(cell *proto.Cell) Var {
+		vector := get(cell)
+		if vector == nil {
+			return &vectorVar{float32Precision: true}
+		}
+		return &vectorVar{X: float64(vector.X), Y: float64(vector.Y), Z: float64(vector.Z), float32Precision: true}
+	})
+	components := map[string]func(v *proto.Vector) float32{
+		"x": func(v *proto.Vector) float32 { return v.X },
+		"y": func(v *proto.Vector) float32 { return v.Y },
+		"z": func(v *proto.Vector) float32 { return v.Z },
+	}
+	for axis, component := range components {
+		component := component
+		registerField(name+"."+axis, TypeNumber, description+", "+axis+" component", func(cell *proto.Cell) Var {
+			vector := get(cell)
+			if vector == nil {
+				return &numberVar{float32Precision: true}
+			}
+			return &numberVar{Value: float64(component(vector)), float32Precision: true}
+		})
+	}
+}
+
+func init() {
+	stringField("cell.id", "id of the cell", func(cell *proto.Cell) string {
+		return cell.Id
+	})
+	numberField("cell.energy_level", "energy level of the cell", func(cell *proto.Cell) float64 {
+		return float64(cell.EnergyLevel)
+	})
+	numberField("cell.energy", "alias of cell.energy_level", func(cell *proto.Cell) float64 {
+		return float64(cell.EnergyLevel)
+	})
+	boolField("cell.dying", "the cell has no energy left", func(cell *proto.Cell) bool {
+		return cell.EnergyLevel == 0
+	})
+	vectorFields("cell.pos", "position of the cell", func(cell *proto.Cell) *proto.Vector {
+		return cell.Pos
+	})
+	vectorFields("cell.vel", "velocity of the cell", func(cell *proto.Cell) *proto.Vector {
+		return cell.Vel
+	})
+	stringField("cell.dna", "dna of the cell as text", func(cell *proto.Cell) string {
+		return string(cell.Dna)
+	})
+	numberField("cell.dna_length", "amount of bases of the dna", func(cell *proto.Cell) float64 {
+		return float64(len(cell.Dna))
+	})
+	numberField("cell.connection_count", "amount of cells the cell is connected to", func(cell *proto.Cell) float64 {
+		return float64(len(cell.Connections))
+	})
+	boolField("cell.connected", "the cell is connected to at least one other cell", func(cell *proto.Cell) bool {
+		return len(cell.Connections) > 0
+	})
+}
+
+//Fields filters can address, sorted by name
+func Fields() []Field {
+	fields := make([]Field, 0, len(fieldRegistry))
+	for _, accessor := range fieldRegistry {
+		fields = append(fields, accessor.Field)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		return fields[i].Name < fields[j].Name
+	})
+	return fields
+}
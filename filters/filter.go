@@ -18,61 +18,125 @@ type FilterDefinition struct {
 type operator int
 
 const (
-	operatorInvalid     operator = iota
-	operatorLessThan    operator = iota
-	operatorGreaterThan operator = iota
-	operatorEqual       operator = iota
+	operatorInvalid            operator = iota
+	operatorLessThan           operator = iota
+	operatorGreaterThan        operator = iota
+	operatorEqual              operator = iota
+	operatorLessThanOrEqual    operator = iota
+	operatorGreaterThanOrEqual operator = iota
+	operatorNotEqual           operator = iota
 )
 
+func parseOperator(raw string) operator {
+	switch raw {
+	case "<":
+		return operatorLessThan
+	case ">":
+		return operatorGreaterThan
+	case "=", "==":
+		return operatorEqual
+	case "<=":
+		return operatorLessThanOrEqual
+	case ">=":
+		return operatorGreaterThanOrEqual
+	case "!=":
+		return operatorNotEqual
+	}
+	return operatorInvalid
+}
+
+//compare the evaluated vars with op
+func compare(op operator, lft, rgt Var) bool {
+	switch op {
+	case operatorLessThan:
+		return lft.LessThan(rgt)
+	case operatorGreaterThan:
+		return lft.GreaterThan(rgt)
+	case operatorEqual:
+		return lft.Equal(rgt)
+	case operatorLessThanOrEqual:
+		return lft.LessThan(rgt) || lft.Equal(rgt)
+	case operatorGreaterThanOrEqual:
+		return lft.GreaterThan(rgt) || lft.Equal(rgt)
+	case operatorNotEqual:
+		return !lft.Equal(rgt)
+	}
+	return false
+}
+
+//checkComparison makes sure both sides of a comparison have the same type and op is defined for it.
+//Invalid sides are not checked, they are reported on their own
+func checkComparison(op operator, lftType, rgtType VarType) error {
+	if lftType == TypeInvalid || rgtType == TypeInvalid || op == operatorInvalid {
+		return nil
+	}
+	if lftType != rgtType {
+		return fmt.Errorf("can't compare %v with %v", lftType, rgtType)
+	}
+	if (lftType == TypeBool || lftType == TypeVector) && op != operatorEqual && op != operatorNotEqual {
+		return fmt.Errorf("%vs can only be compared with = and !=", lftType)
+	}
+	return nil
+}
+
 //Filter ...
 type Filter struct {
 	leftVar Var
 	rgtVar  Var
 	op      operator
+	//compileWarnings about the definition, the filter never passes if there are any
+	compileWarnings []string
 }
 
-//NewFilter from FilterDefinition. Compiles the two sides as far as it can beforehand
+//NewFilter from FilterDefinition. Compiles and type checks the two sides beforehand.
+//A nil definition, like a null in a JSON array, gives a Filter that never passes
 func NewFilter(definition *FilterDefinition) *Filter {
-	var op operator
-	switch definition.Operator {
-	case "<":
-		op = operatorLessThan
-	case ">":
-		op = operatorGreaterThan
-	case "=":
-		op = operatorEqual
-	default:
-		op = operatorInvalid
+	if definition == nil {
+		return &Filter{compileWarnings: []string{"definition is null"}}
 	}
-
-	return &Filter{
+	f := &Filter{
 		leftVar: compileHand(definition.LeftHand, definition.LeftHandType),
 		rgtVar:  compileHand(definition.RightHand, definition.RightHandType),
-		op:      op,
+		op:      parseOperator(definition.Operator),
+	}
+	if !f.leftVar.Valid() {
+		f.compileWarnings = append(f.compileWarnings, fmt.Sprintf("left hand %v is invalid", f.leftVar))
 	}
+	if !f.rgtVar.Valid() {
+		f.compileWarnings = append(f.compileWarnings, fmt.Sprintf("right hand %v is invalid", f.rgtVar))
+	}
+	if f.op == operatorInvalid {
+		f.compileWarnings = append(f.compileWarnings, "operator is invalid")
+	}
+	if err := checkComparison(f.op, f.leftVar.Type(), f.rgtVar.Type()); err != nil {
+		f.compileWarnings = append(f.compileWarnings, err.Error())
+	}
+	return f
+}
+
+//Problems of the definition found while compiling it, a Filter with problems never passes
+func (f *Filter) Problems() []string {
+	return append([]string(nil), f.compileWarnings...)
 }
 
 //Eval filter to see if the cell passes this Filter
 func (f *Filter) Eval(cell *proto.Cell) (passes bool, warnings []string) {
+	if len(f.compileWarnings) > 0 {
+		return false, f.Problems()
+	}
+
 	lftVar := f.leftVar.Eval(cell)
 	if !lftVar.Valid() {
-		warnings = append(warnings, fmt.Sprintf("left hand %v is invalid", *lftVar.(*invalidVar)))
+		warnings = append(warnings, fmt.Sprintf("left hand %v is invalid", lftVar))
 	}
 	rgtVar := f.rgtVar.Eval(cell)
 	if !rgtVar.Valid() {
-		warnings = append(warnings, fmt.Sprintf("right hand %v is invalid", *rgtVar.(*invalidVar)))
+		warnings = append(warnings, fmt.Sprintf("right hand %v is invalid", rgtVar))
 	}
-
-	switch f.op {
-	case operatorLessThan:
-		passes = lftVar.LessThan(rgtVar)
-	case operatorGreaterThan:
-		passes = lftVar.GreaterThan(rgtVar)
-	case operatorEqual:
-		passes = lftVar.Equal(rgtVar)
-	case operatorInvalid:
-		warnings = append(warnings, "operator is invalid")
+	if len(warnings) > 0 {
+		return false, warnings
 	}
+	passes = compare(f.op, lftVar, rgtVar)
 
 	return
 }
@@ -83,7 +147,19 @@ func compileHand(v, t string) Var {
 		return compileNumberVar(v)
 	case "coordinate":
 		return compileCoordinateVar(v)
+	case "field":
+		return compileFieldVar(v)
+	case "string":
+		return &stringVar{Value: v}
+	case "bool":
+		return compileBoolVar(v)
+	case "expression":
+		hand, err := compileHandExpression(v)
+		if err != nil {
+			return &invalidVar{Value: v, RawType: t, Reason: err.Error()}
+		}
+		return hand
 	}
 
-	return &invalidVar{Value: v, Type: t}
+	return &invalidVar{Value: v, RawType: t}
 }
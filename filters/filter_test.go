@@ -47,6 +47,32 @@ func TestFilter(t *testing.T) {
 		assert.Empty(t, warnings)
 	})
 
+	t.Run("legacy coordinate filters compare at float32 precision", func(t *testing.T) {
+		cell := &proto.Cell{Pos: &proto.Vector{X: 0.1}}
+		for operator, expected := range map[string]bool{"=": true, "<": false, ">": false} {
+			filter := NewFilter(&FilterDefinition{
+				LeftHand:      "cell.pos.x",
+				LeftHandType:  "coordinate",
+				Operator:      operator,
+				RightHand:     "0.1",
+				RightHandType: "number",
+			})
+			passed, warnings := filter.Eval(cell)
+			assert.Equal(t, expected, passed, "cell.pos.x %v 0.1", operator)
+			assert.Empty(t, warnings)
+
+			expression, err := CompileExpression("cell.pos.x " + operator + " 0.1")
+			require.NoError(t, err)
+			passed, _ = expression.Eval(cell)
+			assert.Equal(t, expected, passed, "expression cell.pos.x %v 0.1", operator)
+		}
+
+		expression, err := CompileExpression("cell.pos = vec(0.1, 0, 0)")
+		require.NoError(t, err)
+		passed, _ := expression.Eval(cell)
+		assert.True(t, passed)
+	})
+
 	t.Run("filter with coordinate vars on both sides works", func(t *testing.T) {
 		definition := &FilterDefinition{
 			LeftHand:      "cell.pos.x",
@@ -90,4 +116,65 @@ func TestFilter(t *testing.T) {
 			warnings,
 		)
 	})
+	t.Run("filter with field, string and bool vars works", func(t *testing.T) {
+		cell := &proto.Cell{Id: "some-id", EnergyLevel: 0}
+		definitions := []*FilterDefinition{
+			{LeftHand: "cell.id", LeftHandType: "field", Operator: "=", RightHand: "some-id", RightHandType: "string"},
+			{LeftHand: "cell.dying", LeftHandType: "field", Operator: "!=", RightHand: "false", RightHandType: "bool"},
+			{LeftHand: "cell.energy_level", LeftHandType: "field", Operator: "<=", RightHand: "0", RightHandType: "number"},
+		}
+		for _, definition := range definitions {
+			passed, warnings := NewFilter(definition).Eval(cell)
+			assert.True(t, passed, definition.LeftHand)
+			assert.Empty(t, warnings, definition.LeftHand)
+		}
+	})
+
+	t.Run("filter comparing different types outputs a warning", func(t *testing.T) {
+		definitions := map[*FilterDefinition]string{
+			{LeftHand: "cell.id", LeftHandType: "field", Operator: "<", RightHand: "1", RightHandType: "number"}:     "can't compare string with number",
+			{LeftHand: "cell.dying", LeftHandType: "field", Operator: "<", RightHand: "true", RightHandType: "bool"}: "bools can only be compared with = and !=",
+		}
+		for definition, warning := range definitions {
+			passed, warnings := NewFilter(definition).Eval(&proto.Cell{})
+			assert.False(t, passed)
+			assert.Equal(t, []string{warning}, warnings)
+		}
+	})
+	t.Run("filter with expression hands works", func(t *testing.T) {
+		definition := &FilterDefinition{
+			LeftHand:      "dist(cell.pos, vec(0, 0, 0))",
+			LeftHandType:  "expression",
+			Operator:      "<",
+			RightHand:     "cell.energy / len(cell.dna)",
+			RightHandType: "expression",
+		}
+
+		filter := NewFilter(definition)
+		passed, warnings := filter.Eval(&proto.Cell{EnergyLevel: 12, Pos: &proto.Vector{X: 3, Y: 4}, Dna: []byte("AC")})
+		assert.True(t, passed)
+		assert.Empty(t, warnings)
+
+		passed, warnings = filter.Eval(&proto.Cell{EnergyLevel: 10})
+		assert.False(t, passed)
+		assert.Equal(t, []string{"right hand cell.energy / len(cell.dna) (division by zero) is invalid"}, warnings)
+	})
+
+	t.Run("filter with invalid expression hand outputs a warning", func(t *testing.T) {
+		definition := &FilterDefinition{
+			LeftHand:      "sqrt(cell.id)",
+			LeftHandType:  "expression",
+			Operator:      ">",
+			RightHand:     "1",
+			RightHandType: "number",
+		}
+
+		passed, warnings := NewFilter(definition).Eval(&proto.Cell{})
+		assert.False(t, passed)
+		assert.Equal(
+			t,
+			[]string{"left hand sqrt(cell.id) (position 0: argument 1 of sqrt has to be a number but is a string) is invalid"},
+			warnings,
+		)
+	})
 }
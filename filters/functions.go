@@ -0,0 +1,176 @@
+package filters
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/codeuniversity/al-proto"
+)
+
+//arithmeticVar applies +, -, * or / to two numbers
+type arithmeticVar struct {
+	op       byte
+	lft, rgt Var
+	//source of the arithmetic in the expression, to point at it in warnings
+	source string
+}
+
+func (v *arithmeticVar) Eval(cell *proto.Cell) Var {
+	lft := v.lft.Eval(cell)
+	if !lft.Valid() {
+		return lft
+	}
+	rgt := v.rgt.Eval(cell)
+	if !rgt.Valid() {
+		return rgt
+	}
+	lftValue, rgtValue := lft.(*numberVar).Value, rgt.(*numberVar).Value
+
+	switch v.op {
+	case '+':
+		return &numberVar{Value: lftValue + rgtValue}
+	case '-':
+		return &numberVar{Value: lftValue - rgtValue}
+	case '*':
+		return &numberVar{Value: lftValue * rgtValue}
+	}
+	if rgtValue == 0 {
+		return &invalidVar{Value: v.source, Reason: "division by zero"}
+	}
+	return &numberVar{Value: lftValue / rgtValue}
+}
+
+func (v *arithmeticVar) Valid() bool {
+	return true
+}
+
+func (v *arithmeticVar) Type() VarType {
+	return TypeNumber
+}
+
+//LessThan, GreaterThan and Equal are never called, the arithmeticVar is replaced by its result through Eval
+func (v *arithmeticVar) LessThan(other Var) bool {
+	return false
+}
+func (v *arithmeticVar) GreaterThan(other Var) bool {
+	return false
+}
+func (v *arithmeticVar) Equal(other Var) bool {
+	return false
+}
+
+//function that can be called in a hand, like sqrt(cell.energy)
+type function struct {
+	parameters []VarType
+	result     VarType
+	//apply the function to valid arguments of the parameter types,
+	//returns an invalidVar with a Reason if the result is undefined
+	apply func(args []Var) Var
+}
+
+//functions by their name
+var functions = map[string]*function{
+	"abs": {
+		parameters: []VarType{TypeNumber},
+		result:     TypeNumber,
+		apply: func(args []Var) Var {
+			return &numberVar{Value: math.Abs(args[0].(*numberVar).Value)}
+		},
+	},
+	"sqrt": {
+		parameters: []VarType{TypeNumber},
+		result:     TypeNumber,
+		apply: func(args []Var) Var {
+			value := args[0].(*numberVar).Value
+			if value < 0 {
+				return &invalidVar{Reason: "square root of a negative number"}
+			}
+			return &numberVar{Value: math.Sqrt(value)}
+		},
+	},
+	"len": {
+		parameters: []VarType{TypeString},
+		result:     TypeNumber,
+		apply: func(args []Var) Var {
+			return &numberVar{Value: float64(len(args[0].(*stringVar).Value))}
+		},
+	},
+	"vec": {
+		parameters: []VarType{TypeNumber, TypeNumber, TypeNumber},
+		result:     TypeVector,
+		apply: func(args []Var) Var {
+			return &vectorVar{
+				X: args[0].(*numberVar).Value,
+				Y: args[1].(*numberVar).Value,
+				Z: args[2].(*numberVar).Value,
+			}
+		},
+	},
+	"dist": {
+		parameters: []VarType{TypeVector, TypeVector},
+		result:     TypeNumber,
+		apply: func(args []Var) Var {
+			a, b := args[0].(*vectorVar), args[1].(*vectorVar)
+			return &numberVar{Value: math.Sqrt((a.X-b.X)*(a.X-b.X) + (a.Y-b.Y)*(a.Y-b.Y) + (a.Z-b.Z)*(a.Z-b.Z))}
+		},
+	},
+}
+
+//compileCall of the function with the given name, checking the amount and types of the arguments
+func compileCall(name string, args []Var, source string) (Var, error) {
+	f, ok := functions[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown function %v", name)
+	}
+	if len(args) != len(f.parameters) {
+		return nil, fmt.Errorf("%v takes %v arguments but got %v", name, len(f.parameters), len(args))
+	}
+	for i, arg := range args {
+		if arg.Type() != f.parameters[i] {
+			return nil, fmt.Errorf("argument %v of %v has to be a %v but is a %v", i+1, name, f.parameters[i], arg.Type())
+		}
+	}
+	return &callVar{function: f, args: args, source: source}, nil
+}
+
+//callVar evaluates its arguments for the cell and applies the function to them
+type callVar struct {
+	function *function
+	args     []Var
+	source   string
+}
+
+func (v *callVar) Eval(cell *proto.Cell) Var {
+	values := make([]Var, len(v.args))
+	for i, arg := range v.args {
+		values[i] = arg.Eval(cell)
+		if !values[i].Valid() {
+			return values[i]
+		}
+	}
+	result := v.function.apply(values)
+	if invalid, ok := result.(*invalidVar); ok && invalid.Value == "" {
+		invalid.Value = v.source
+	}
+	return result
+}
+
+func (v *callVar) Valid() bool {
+	return true
+}
+
+func (v *callVar) Type() VarType {
+	return v.function.result
+}
+
+//LessThan, GreaterThan and Equal are never called, the callVar is replaced by its result through Eval
+func (v *callVar) LessThan(other Var) bool {
+	return false
+}
+func (v *callVar) GreaterThan(other Var) bool {
+	return false
+}
+func (v *callVar) Equal(other Var) bool {
+	return false
+}
@@ -0,0 +1,179 @@
+package filters
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+	tokenArithmetic
+	tokenComma
+	tokenLeftParen
+	tokenRightParen
+	tokenRange
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenIn
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	//pos is the byte offset of the token in the expression
+	pos int
+}
+
+func (t token) String() string {
+	if t.kind == tokenEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+//SyntaxError of an expression at the byte offset Pos
+type SyntaxError struct {
+	Pos int    `json:"pos"`
+	Msg string `json:"msg"`
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("position %v: %v", e.Pos, e.Msg)
+}
+
+var keywords = map[string]tokenKind{
+	"and": tokenAnd,
+	"or":  tokenOr,
+	"not": tokenNot,
+	"in":  tokenIn,
+}
+
+//symbols are matched longest first
+var symbols = []struct {
+	text string
+	kind tokenKind
+}{
+	{"..", tokenRange},
+	{"<=", tokenOperator},
+	{">=", tokenOperator},
+	{"!=", tokenOperator},
+	{"==", tokenOperator},
+	{"&&", tokenAnd},
+	{"||", tokenOr},
+	{"<", tokenOperator},
+	{">", tokenOperator},
+	{"=", tokenOperator},
+	{"!", tokenNot},
+	{"+", tokenArithmetic},
+	{"-", tokenArithmetic},
+	{"*", tokenArithmetic},
+	{"/", tokenArithmetic},
+	{",", tokenComma},
+	{"(", tokenLeftParen},
+	{")", tokenRightParen},
+}
+
+//lex splits the expression into tokens, ending with a tokenEOF
+func lex(expression string) ([]token, error) {
+	tokens := []token{}
+	pos := 0
+	for pos < len(expression) {
+		c := rune(expression[pos])
+		switch {
+		case unicode.IsSpace(c):
+			pos++
+		case isDigit(c) || (c == '-' && pos+1 < len(expression) && isDigit(rune(expression[pos+1])) && expectsOperand(tokens)):
+			end := scanNumber(expression, pos)
+			tokens = append(tokens, token{kind: tokenNumber, text: expression[pos:end], pos: pos})
+			pos = end
+		case c == '"' || c == '\'':
+			end := strings.IndexRune(expression[pos+1:], c)
+			if end < 0 {
+				return nil, &SyntaxError{Pos: pos, Msg: "unterminated string"}
+			}
+			end += pos + 1
+			tokens = append(tokens, token{kind: tokenString, text: expression[pos+1 : end], pos: pos})
+			pos = end + 1
+		case isIdentStart(c):
+			end := pos
+			// two dots are a range operator following the identifier
+			for end < len(expression) && isIdentPart(rune(expression[end])) && !strings.HasPrefix(expression[end:], "..") {
+				end++
+			}
+			text := expression[pos:end]
+			kind, ok := keywords[strings.ToLower(text)]
+			if !ok {
+				kind = tokenIdent
+			}
+			tokens = append(tokens, token{kind: kind, text: text, pos: pos})
+			pos = end
+		default:
+			matched := false
+			for _, symbol := range symbols {
+				if strings.HasPrefix(expression[pos:], symbol.text) {
+					tokens = append(tokens, token{kind: symbol.kind, text: symbol.text, pos: pos})
+					pos += len(symbol.text)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, &SyntaxError{Pos: pos, Msg: fmt.Sprintf("unexpected character %q", c)}
+			}
+		}
+	}
+	return append(tokens, token{kind: tokenEOF, pos: len(expression)}), nil
+}
+
+//scanNumber returns the end of the number starting at pos. A dot is only part of the number if a digit follows it,
+//so "1..5" is lexed as a range
+func scanNumber(expression string, pos int) int {
+	end := pos + 1
+	seenDot := false
+	for end < len(expression) {
+		c := rune(expression[end])
+		if isDigit(c) {
+			end++
+			continue
+		}
+		if c == '.' && !seenDot && end+1 < len(expression) && isDigit(rune(expression[end+1])) {
+			seenDot = true
+			end++
+			continue
+		}
+		break
+	}
+	return end
+}
+
+//expectsOperand if a minus at this point can only be the sign of a number
+func expectsOperand(tokens []token) bool {
+	if len(tokens) == 0 {
+		return true
+	}
+	switch tokens[len(tokens)-1].kind {
+	case tokenNumber, tokenString, tokenIdent, tokenRightParen:
+		return false
+	}
+	return true
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c rune) bool {
+	return c == '_' || unicode.IsLetter(c)
+}
+
+func isIdentPart(c rune) bool {
+	return isIdentStart(c) || isDigit(c) || c == '.'
+}
@@ -0,0 +1,248 @@
+package filters
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/codeuniversity/al-proto"
+)
+
+//Point in the simulation, as [x, y, z]
+type Point [3]float64
+
+//Region of the simulation a viewer looks at. Regions let the websocket skip whole buckets of cells
+type Region interface {
+	Contains(p Point) bool
+	//IntersectsBox of the axis-aligned box from min to max. It may return true for boxes that are just close to the region,
+	//but never false for boxes that intersect it
+	IntersectsBox(min, max Point) bool
+}
+
+//RegionDefinition of a box, sphere or frustum, sent by a client as JSON
+type RegionDefinition struct {
+	//Type is one of box, sphere and frustum
+	Type string `json:"type"`
+
+	//Min and Max corners of a box
+	Min Point `json:"min"`
+	Max Point `json:"max"`
+
+	//Center and Radius of a sphere
+	Center Point   `json:"center"`
+	Radius float64 `json:"radius"`
+
+	//Position, Direction and Up of the camera of a frustum
+	Position  Point `json:"position"`
+	Direction Point `json:"direction"`
+	Up        Point `json:"up"`
+	//FOV is the vertical field of view of the camera in degrees
+	FOV float64 `json:"fov"`
+	//Aspect is the ratio of width to height
+	Aspect float64 `json:"aspect"`
+	Near   float64 `json:"near"`
+	Far    float64 `json:"far"`
+}
+
+//NewRegion from RegionDefinition
+func NewRegion(definition *RegionDefinition) (Region, error) {
+	switch definition.Type {
+	case "box":
+		for axis := range definition.Min {
+			if definition.Min[axis] > definition.Max[axis] {
+				return nil, errors.New("min of the box has to be less than or equal to max")
+			}
+		}
+		return &Box{Min: definition.Min, Max: definition.Max}, nil
+	case "sphere":
+		if definition.Radius < 0 {
+			return nil, errors.New("radius of the sphere can't be negative")
+		}
+		return &Sphere{Center: definition.Center, Radius: definition.Radius}, nil
+	case "frustum":
+		return NewFrustum(definition)
+	}
+	return nil, fmt.Errorf("unknown region type %q, use box, sphere or frustum", definition.Type)
+}
+
+//Box is an axis-aligned box from Min to Max
+type Box struct {
+	Min, Max Point
+}
+
+//Contains p if it is within the box, including its faces
+func (b *Box) Contains(p Point) bool {
+	for axis := range p {
+		if p[axis] < b.Min[axis] || p[axis] > b.Max[axis] {
+			return false
+		}
+	}
+	return true
+}
+
+//IntersectsBox if the boxes overlap
+func (b *Box) IntersectsBox(min, max Point) bool {
+	for axis := range min {
+		if max[axis] < b.Min[axis] || min[axis] > b.Max[axis] {
+			return false
+		}
+	}
+	return true
+}
+
+//Sphere around Center
+type Sphere struct {
+	Center Point
+	Radius float64
+}
+
+//Contains p if it is within the sphere, including its surface
+func (s *Sphere) Contains(p Point) bool {
+	return squaredDistance(p, s.Center) <= s.Radius*s.Radius
+}
+
+//IntersectsBox if the point of the box closest to the center is within the sphere
+func (s *Sphere) IntersectsBox(min, max Point) bool {
+	closest := Point{}
+	for axis := range closest {
+		closest[axis] = math.Max(min[axis], math.Min(s.Center[axis], max[axis]))
+	}
+	return s.Contains(closest)
+}
+
+//plane with a normal pointing into the region it bounds
+type plane struct {
+	normal Point
+	offset float64
+}
+
+func newPlane(normal, through Point) plane {
+	return plane{normal: normal, offset: dot(normal, through)}
+}
+
+func (p plane) distance(point Point) float64 {
+	return dot(p.normal, point) - p.offset
+}
+
+//Frustum is the part of the simulation a perspective camera sees, bounded by six planes
+type Frustum struct {
+	planes [6]plane
+}
+
+//NewFrustum of the camera of the RegionDefinition
+func NewFrustum(definition *RegionDefinition) (*Frustum, error) {
+	if definition.FOV <= 0 || definition.FOV >= 180 {
+		return nil, errors.New("fov of the frustum has to be between 0 and 180 degrees")
+	}
+	if definition.Aspect <= 0 {
+		return nil, errors.New("aspect of the frustum has to be positive")
+	}
+	if definition.Near < 0 || definition.Far <= definition.Near {
+		return nil, errors.New("near of the frustum has to be positive and less than far")
+	}
+	direction, ok := normalize(definition.Direction)
+	if !ok {
+		return nil, errors.New("direction of the frustum can't be zero")
+	}
+	right, ok := normalize(cross(direction, definition.Up))
+	if !ok {
+		return nil, errors.New("up of the frustum can't be zero or parallel to the direction")
+	}
+	up := cross(right, direction)
+
+	halfHeight := math.Tan(definition.FOV * math.Pi / 360)
+	halfWidth := halfHeight * definition.Aspect
+	left := add(direction, scale(right, -halfWidth))
+	rightEdge := add(direction, scale(right, halfWidth))
+	bottom := add(direction, scale(up, -halfHeight))
+	top := add(direction, scale(up, halfHeight))
+
+	position := definition.Position
+	return &Frustum{planes: [6]plane{
+		newPlane(direction, add(position, scale(direction, definition.Near))),
+		newPlane(scale(direction, -1), add(position, scale(direction, definition.Far))),
+		newPlane(cross(left, up), position),
+		newPlane(cross(up, rightEdge), position),
+		newPlane(cross(right, bottom), position),
+		newPlane(cross(top, right), position),
+	}}, nil
+}
+
+//Contains p if it is on the inner side of all planes
+func (f *Frustum) Contains(p Point) bool {
+	for _, plane := range f.planes {
+		if plane.distance(p) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+//IntersectsBox unless the box is completely on the outer side of one of the planes.
+//Boxes close to the edges of the frustum may pass without intersecting it
+func (f *Frustum) IntersectsBox(min, max Point) bool {
+	for _, plane := range f.planes {
+		//the corner of the box the furthest along the normal
+		corner := min
+		for axis := range corner {
+			if plane.normal[axis] >= 0 {
+				corner[axis] = max[axis]
+			}
+		}
+		if plane.distance(corner) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+//RegionFilter lets the cells within Region pass, that also pass Filter if it is set
+type RegionFilter struct {
+	Region Region
+	Filter Evaluator
+}
+
+//Eval the region filter to see if the cell passes it
+func (f *RegionFilter) Eval(cell *proto.Cell) (passes bool, warnings []string) {
+	if cell.Pos == nil || !f.Region.Contains(Point{float64(cell.Pos.X), float64(cell.Pos.Y), float64(cell.Pos.Z)}) {
+		return false, nil
+	}
+	if f.Filter == nil {
+		return true, nil
+	}
+	return f.Filter.Eval(cell)
+}
+
+func dot(a, b Point) float64 {
+	return a[0]*b[0] + a[1]*b[1] + a[2]*b[2]
+}
+
+func cross(a, b Point) Point {
+	return Point{
+		a[1]*b[2] - a[2]*b[1],
+		a[2]*b[0] - a[0]*b[2],
+		a[0]*b[1] - a[1]*b[0],
+	}
+}
+
+func add(a, b Point) Point {
+	return Point{a[0] + b[0], a[1] + b[1], a[2] + b[2]}
+}
+
+func scale(a Point, factor float64) Point {
+	return Point{a[0] * factor, a[1] * factor, a[2] * factor}
+}
+
+func squaredDistance(a, b Point) float64 {
+	difference := add(a, scale(b, -1))
+	return dot(difference, difference)
+}
+
+//normalize a to length 1, false if it has no length
+func normalize(a Point) (Point, bool) {
+	length := math.Sqrt(dot(a, a))
+	if length == 0 {
+		return a, false
+	}
+	return scale(a, 1/length), true
+}
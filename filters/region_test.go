@@ -0,0 +1,85 @@
+package filters
+
+import (
+	"testing"
+
+	"github.com/codeuniversity/al-proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegions(t *testing.T) {
+	t.Run("box", func(t *testing.T) {
+		box := &Box{Min: Point{0, 0, 0}, Max: Point{10, 10, 10}}
+
+		assert.True(t, box.Contains(Point{10, 0, 5}))
+		assert.False(t, box.Contains(Point{10.1, 0, 5}))
+		assert.True(t, box.IntersectsBox(Point{-5, -5, -5}, Point{0, 0, 0}))
+		assert.True(t, box.IntersectsBox(Point{2, 2, 2}, Point{3, 3, 3}))
+		assert.False(t, box.IntersectsBox(Point{11, 0, 0}, Point{20, 10, 10}))
+	})
+
+	t.Run("sphere", func(t *testing.T) {
+		sphere := &Sphere{Center: Point{0, 0, 0}, Radius: 5}
+
+		assert.True(t, sphere.Contains(Point{3, 4, 0}))
+		assert.False(t, sphere.Contains(Point{3, 4, 1}))
+		assert.True(t, sphere.IntersectsBox(Point{-100, -100, -100}, Point{100, 100, 100}))
+		assert.True(t, sphere.IntersectsBox(Point{3, 4, -1}, Point{10, 10, 1}))
+		assert.False(t, sphere.IntersectsBox(Point{4, 4, 4}, Point{10, 10, 10}))
+	})
+
+	t.Run("frustum", func(t *testing.T) {
+		frustum, err := NewFrustum(&RegionDefinition{
+			Type:      "frustum",
+			Position:  Point{0, 0, 0},
+			Direction: Point{0, 0, -1},
+			Up:        Point{0, 1, 0},
+			FOV:       90,
+			Aspect:    2,
+			Near:      1,
+			Far:       100,
+		})
+		require.NoError(t, err)
+
+		assert.True(t, frustum.Contains(Point{0, 0, -50}))
+		assert.True(t, frustum.Contains(Point{19, 9, -10}), "the frustum is twice as wide as high")
+		assert.False(t, frustum.Contains(Point{0, 11, -10}))
+		assert.False(t, frustum.Contains(Point{21, 0, -10}))
+		assert.False(t, frustum.Contains(Point{0, 0, 10}), "behind the camera")
+		assert.False(t, frustum.Contains(Point{0, 0, -0.5}), "before the near plane")
+		assert.False(t, frustum.Contains(Point{0, 0, -101}), "after the far plane")
+
+		assert.True(t, frustum.IntersectsBox(Point{-1, -1, -200}, Point{1, 1, -99}))
+		assert.True(t, frustum.IntersectsBox(Point{-1000, -1000, -1000}, Point{1000, 1000, 1000}))
+		assert.False(t, frustum.IntersectsBox(Point{-10, -10, 0}, Point{10, 10, 10}))
+		assert.False(t, frustum.IntersectsBox(Point{50, -10, -20}, Point{60, 10, -10}))
+	})
+
+	t.Run("invalid definitions", func(t *testing.T) {
+		for _, definition := range []*RegionDefinition{
+			{Type: "cube"},
+			{Type: "sphere", Radius: -1},
+			{Type: "frustum", Direction: Point{0, 0, -1}, Up: Point{0, 1, 0}, FOV: 0, Aspect: 1, Near: 1, Far: 10},
+			{Type: "frustum", Direction: Point{0, 0, -1}, Up: Point{0, 0, 1}, FOV: 60, Aspect: 1, Near: 1, Far: 10},
+			{Type: "frustum", Direction: Point{0, 0, 0}, Up: Point{0, 1, 0}, FOV: 60, Aspect: 1, Near: 1, Far: 10},
+			{Type: "frustum", Direction: Point{0, 0, -1}, Up: Point{0, 1, 0}, FOV: 60, Aspect: 1, Near: 10, Far: 1},
+		} {
+			_, err := NewRegion(definition)
+			assert.Error(t, err, "%+v", definition)
+		}
+	})
+
+	t.Run("region filter", func(t *testing.T) {
+		inner, err := CompileExpression("cell.energy > 1")
+		require.NoError(t, err)
+		filter := &RegionFilter{Region: &Box{Max: Point{10, 10, 10}}, Filter: inner}
+
+		passes, _ := filter.Eval(&proto.Cell{EnergyLevel: 2, Pos: &proto.Vector{X: 5}})
+		assert.True(t, passes)
+		passes, _ = filter.Eval(&proto.Cell{EnergyLevel: 1, Pos: &proto.Vector{X: 5}})
+		assert.False(t, passes)
+		passes, _ = filter.Eval(&proto.Cell{EnergyLevel: 2, Pos: &proto.Vector{X: 11}})
+		assert.False(t, passes)
+	})
+}
@@ -29,3 +29,14 @@ func (s Set) Eval(cell *proto.Cell) (passes bool, warnings []string) {
 
 	return
 }
+
+//Problems of the definitions the set was compiled from by their index, empty if all of them compile
+func (s Set) Problems() map[int][]string {
+	problems := map[int][]string{}
+	for i, filter := range s {
+		if filterProblems := filter.Problems(); len(filterProblems) > 0 {
+			problems[i] = filterProblems
+		}
+	}
+	return problems
+}
@@ -0,0 +1,63 @@
+package filters
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//ValidationError explains why a filter was rejected, see Validate
+type ValidationError struct {
+	Msg string `json:"msg"`
+	//Pos of the problem in an expression, only set for syntax errors
+	Pos *int `json:"pos,omitempty"`
+	//Definitions maps the index of every invalid definition of a JSON array to its problems
+	Definitions map[int][]string `json:"definitions,omitempty"`
+}
+
+func (e *ValidationError) Error() string {
+	return e.Msg
+}
+
+//Validate a filter sent by a client, see Parse for the accepted forms.
+//Unlike Parse, definitions that don't compile are rejected instead of warning about them for every cell,
+//and an empty array is rejected as it is no filter
+func Validate(message []byte) (Evaluator, *ValidationError) {
+	evaluator, err := Parse(message)
+	if err != nil {
+		validationErr := &ValidationError{Msg: err.Error()}
+		if syntaxErr, ok := err.(*SyntaxError); ok {
+			validationErr.Pos = &syntaxErr.Pos
+		}
+		return nil, validationErr
+	}
+	if evaluator == nil {
+		return nil, &ValidationError{Msg: "an empty array is no filter"}
+	}
+
+	set, ok := evaluator.(Set)
+	if !ok {
+		return evaluator, nil
+	}
+	problems := set.Problems()
+	if len(problems) == 0 {
+		return evaluator, nil
+	}
+	return nil, &ValidationError{
+		Msg:         fmt.Sprintf("invalid filter definitions at index %v", invalidIndices(problems)),
+		Definitions: problems,
+	}
+}
+
+func invalidIndices(problems map[int][]string) string {
+	indices := make([]int, 0, len(problems))
+	for i := range problems {
+		indices = append(indices, i)
+	}
+	sort.Ints(indices)
+	texts := make([]string, len(indices))
+	for i, index := range indices {
+		texts[i] = fmt.Sprint(index)
+	}
+	return strings.Join(texts, ", ")
+}
@@ -1,15 +1,30 @@
 package filters
 
 import (
+	"fmt"
 	"strconv"
 
 	"github.com/codeuniversity/al-proto"
 )
 
+//VarType is the type of the value a Var evaluates to
+type VarType string
+
+//VarTypes of the values filters can compare
+const (
+	TypeNumber  VarType = "number"
+	TypeString  VarType = "string"
+	TypeBool    VarType = "bool"
+	TypeVector  VarType = "vector"
+	TypeInvalid VarType = "invalid"
+)
+
 //Var is one side of a filter
 type Var interface {
 	Eval(*proto.Cell) Var
 	Valid() bool
+	//Type of the value Eval returns, known before any cell is evaluated
+	Type() VarType
 
 	LessThan(Var) bool
 	GreaterThan(Var) bool
@@ -17,16 +32,19 @@ type Var interface {
 }
 
 type numberVar struct {
-	Value float32
+	Value float64
+	//float32Precision is set for the values of float32 fields of the cell, like the position.
+	//They are compared at float32 precision, so that cell.pos.x = 0.1 matches a cell at 0.1
+	float32Precision bool
 }
 
 func compileNumberVar(rawValue string) Var {
-	value, err := strconv.ParseFloat(rawValue, 32)
+	value, err := strconv.ParseFloat(rawValue, 64)
 	if err != nil {
-		return &invalidVar{Value: rawValue, Type: "number"}
+		return &invalidVar{Value: rawValue, RawType: "number"}
 	}
 
-	return &numberVar{Value: float32(value)}
+	return &numberVar{Value: value}
 }
 
 func (v *numberVar) Eval(*proto.Cell) Var {
@@ -36,88 +54,214 @@ func (v *numberVar) Valid() bool {
 	return true
 }
 
+func (v *numberVar) Type() VarType {
+	return TypeNumber
+}
+
+//comparableValues of v and other, rounded to float32 if one of them has float32 precision
+func (v *numberVar) comparableValues(other Var) (value, otherValue float64, ok bool) {
+	otherNumber, ok := other.(*numberVar)
+	if !ok {
+		return 0, 0, false
+	}
+	if v.float32Precision || otherNumber.float32Precision {
+		return float64(float32(v.Value)), float64(float32(otherNumber.Value)), true
+	}
+	return v.Value, otherNumber.Value, true
+}
+
 func (v *numberVar) LessThan(other Var) bool {
-	switch other.(type) {
-	case *numberVar:
-		return v.Value < (other.(*numberVar)).Value
+	value, otherValue, ok := v.comparableValues(other)
+	return ok && value < otherValue
+}
+
+func (v *numberVar) GreaterThan(other Var) bool {
+	value, otherValue, ok := v.comparableValues(other)
+	return ok && value > otherValue
+}
+
+func (v *numberVar) Equal(other Var) bool {
+	value, otherValue, ok := v.comparableValues(other)
+	return ok && value == otherValue
+}
+
+//stringVar is compared lexicographically
+type stringVar struct {
+	Value string
+}
+
+func (v *stringVar) Eval(*proto.Cell) Var {
+	return v
+}
+
+func (v *stringVar) Valid() bool {
+	return true
+}
+
+func (v *stringVar) Type() VarType {
+	return TypeString
+}
+
+func (v *stringVar) LessThan(other Var) bool {
+	if other, ok := other.(*stringVar); ok {
+		return v.Value < other.Value
 	}
+	return false
+}
 
+func (v *stringVar) GreaterThan(other Var) bool {
+	if other, ok := other.(*stringVar); ok {
+		return v.Value > other.Value
+	}
 	return false
 }
 
-func (v *numberVar) GreaterThan(other Var) bool {
-	switch other.(type) {
-	case *numberVar:
-		return v.Value > (other.(*numberVar)).Value
+func (v *stringVar) Equal(other Var) bool {
+	if other, ok := other.(*stringVar); ok {
+		return v.Value == other.Value
 	}
+	return false
+}
+
+//boolVar is only equal or not equal to other bools, it is neither less nor greater
+type boolVar struct {
+	Value bool
+}
+
+func compileBoolVar(rawValue string) Var {
+	value, err := strconv.ParseBool(rawValue)
+	if err != nil {
+		return &invalidVar{Value: rawValue, RawType: "bool"}
+	}
+	return &boolVar{Value: value}
+}
 
+func (v *boolVar) Eval(*proto.Cell) Var {
+	return v
+}
+
+func (v *boolVar) Valid() bool {
+	return true
+}
+
+func (v *boolVar) Type() VarType {
+	return TypeBool
+}
+
+func (v *boolVar) LessThan(other Var) bool {
 	return false
 }
-func (v *numberVar) Equal(other Var) bool {
-	switch other.(type) {
-	case *numberVar:
-		return v.Value == (other.(*numberVar)).Value
+
+func (v *boolVar) GreaterThan(other Var) bool {
+	return false
+}
+
+func (v *boolVar) Equal(other Var) bool {
+	if other, ok := other.(*boolVar); ok {
+		return v.Value == other.Value
 	}
+	return false
+}
+
+//vectorVar is only equal or not equal to other vectors, see the functions dist and vec
+type vectorVar struct {
+	X, Y, Z float64
+	//float32Precision like numberVar, for the vectors of the cell
+	float32Precision bool
+}
+
+func (v *vectorVar) Eval(*proto.Cell) Var {
+	return v
+}
+
+func (v *vectorVar) Valid() bool {
+	return true
+}
 
+func (v *vectorVar) Type() VarType {
+	return TypeVector
+}
+
+func (v *vectorVar) LessThan(other Var) bool {
 	return false
+}
 
+func (v *vectorVar) GreaterThan(other Var) bool {
+	return false
 }
 
-type coordinate int
+func (v *vectorVar) Equal(other Var) bool {
+	otherVector, ok := other.(*vectorVar)
+	if !ok {
+		return false
+	}
+	if v.float32Precision || otherVector.float32Precision {
+		return float32(v.X) == float32(otherVector.X) && float32(v.Y) == float32(otherVector.Y) && float32(v.Z) == float32(otherVector.Z)
+	}
+	return v.X == otherVector.X && v.Y == otherVector.Y && v.Z == otherVector.Z
+}
 
-const (
-	coordinateX coordinate = iota
-	coordinateY coordinate = iota
-	coordinateZ coordinate = iota
-)
+//fieldVar evaluates to the value of a field of the cell, see Fields
+type fieldVar struct {
+	field *fieldAccessor
+}
 
-type coordinateVar struct {
-	Coordinate coordinate
+//compileFieldVar of any field in the registry
+func compileFieldVar(rawValue string) Var {
+	field, ok := fieldRegistry[rawValue]
+	if !ok {
+		return &invalidVar{Value: rawValue, RawType: "field"}
+	}
+	return &fieldVar{field: field}
 }
 
+//compileCoordinateVar only resolves the position fields, for definitions of the "coordinate" type
 func compileCoordinateVar(rawValue string) Var {
 	switch rawValue {
-	case "cell.pos.x":
-		return &coordinateVar{Coordinate: coordinateX}
-	case "cell.pos.y":
-		return &coordinateVar{Coordinate: coordinateY}
-	case "cell.pos.z":
-		return &coordinateVar{Coordinate: coordinateZ}
+	case "cell.pos.x", "cell.pos.y", "cell.pos.z":
+		return compileFieldVar(rawValue)
 	}
 
-	return &invalidVar{Value: rawValue, Type: "coordinate"}
+	return &invalidVar{Value: rawValue, RawType: "coordinate"}
 }
 
-func (v *coordinateVar) Eval(cell *proto.Cell) Var {
-	switch v.Coordinate {
-	case coordinateX:
-		return &numberVar{Value: cell.Pos.X}
-	case coordinateY:
-		return &numberVar{Value: cell.Pos.Y}
-	case coordinateZ:
-		return &numberVar{Value: cell.Pos.Z}
-	}
-
-	return &invalidVar{}
+func (v *fieldVar) Eval(cell *proto.Cell) Var {
+	return v.field.get(cell)
 }
 
-func (v *coordinateVar) Valid() bool {
+func (v *fieldVar) Valid() bool {
 	return true
 }
 
-func (v *coordinateVar) LessThan(other Var) bool {
+func (v *fieldVar) Type() VarType {
+	return v.field.Type
+}
+
+//LessThan, GreaterThan and Equal are never called, as a fieldVar is replaced by the value of the field through Eval
+//before it is compared. Mismatching types are rejected when a filter is compiled, see checkComparison
+func (v *fieldVar) LessThan(other Var) bool {
 	return false
 }
-func (v *coordinateVar) GreaterThan(other Var) bool {
+func (v *fieldVar) GreaterThan(other Var) bool {
 	return false
 }
-func (v *coordinateVar) Equal(other Var) bool {
+func (v *fieldVar) Equal(other Var) bool {
 	return false
 }
 
+//invalidVar is either a hand that couldn't be compiled or the result of an evaluation that failed for a cell,
+//in which case Reason is set
 type invalidVar struct {
-	Value string
-	Type  string
+	Value   string
+	RawType string
+	Reason  string
+}
+
+func (v invalidVar) String() string {
+	if v.Reason != "" {
+		return fmt.Sprintf("%v (%v)", v.Value, v.Reason)
+	}
+	return fmt.Sprintf("{%v %v}", v.Value, v.RawType)
 }
 
 func (v *invalidVar) Eval(*proto.Cell) Var {
@@ -128,6 +272,10 @@ func (v *invalidVar) Valid() bool {
 	return false
 }
 
+func (v *invalidVar) Type() VarType {
+	return TypeInvalid
+}
+
 func (v *invalidVar) LessThan(other Var) bool {
 	return false
 }
@@ -6,6 +6,7 @@ import (
 	"github.com/codeuniversity/al-proto"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestVars(t *testing.T) {
@@ -20,9 +21,9 @@ func TestVars(t *testing.T) {
 	})
 
 	t.Run("coordinate vars eval into correct number vars", func(t *testing.T) {
-		coordinateXVar := &coordinateVar{Coordinate: coordinateX}
-		coordinateYVar := &coordinateVar{Coordinate: coordinateY}
-		coordinateZVar := &coordinateVar{Coordinate: coordinateZ}
+		coordinateXVar := compileCoordinateVar("cell.pos.x")
+		coordinateYVar := compileCoordinateVar("cell.pos.y")
+		coordinateZVar := compileCoordinateVar("cell.pos.z")
 		numberVar := &numberVar{Value: 4}
 		firstCell := &proto.Cell{Pos: &proto.Vector{X: 1, Y: 2, Z: 3}}
 
@@ -41,4 +42,60 @@ func TestVars(t *testing.T) {
 		assert.False(t, coordinateYVar.Eval(secondCell).LessThan(numberVar))
 		assert.False(t, coordinateZVar.Eval(secondCell).LessThan(numberVar))
 	})
+	t.Run("string vars compare lexicographically", func(t *testing.T) {
+		lftVar := &stringVar{Value: "a"}
+		rgtVar := &stringVar{Value: "b"}
+
+		assert.True(t, lftVar.LessThan(rgtVar))
+		assert.False(t, lftVar.GreaterThan(rgtVar))
+		assert.True(t, lftVar.Equal(&stringVar{Value: "a"}))
+		assert.False(t, lftVar.Equal(&numberVar{Value: 1}))
+	})
+
+	t.Run("bool vars are only equal or not", func(t *testing.T) {
+		trueVar := compileBoolVar("true")
+		falseVar := compileBoolVar("false")
+
+		assert.True(t, trueVar.Equal(&boolVar{Value: true}))
+		assert.False(t, trueVar.Equal(falseVar))
+		assert.False(t, falseVar.LessThan(trueVar))
+		assert.False(t, trueVar.GreaterThan(falseVar))
+		assert.False(t, compileBoolVar("yes").Valid())
+	})
+
+	t.Run("field vars eval into the value of the field", func(t *testing.T) {
+		cell := &proto.Cell{
+			Id:          "some-id",
+			EnergyLevel: 0,
+			Vel:         &proto.Vector{X: -1},
+			Dna:         []byte("ACG"),
+			Connections: []*proto.Connection{{ConnectedTo: "other-id"}},
+		}
+		expected := map[string]Var{
+			"cell.id":               &stringVar{Value: "some-id"},
+			"cell.energy":           &numberVar{Value: 0},
+			"cell.dying":            &boolVar{Value: true},
+			"cell.pos.x":            &numberVar{Value: 0, float32Precision: true},
+			"cell.vel.x":            &numberVar{Value: -1, float32Precision: true},
+			"cell.dna":              &stringVar{Value: "ACG"},
+			"cell.dna_length":       &numberVar{Value: 3},
+			"cell.connection_count": &numberVar{Value: 1},
+			"cell.connected":        &boolVar{Value: true},
+		}
+		for name, value := range expected {
+			field := compileFieldVar(name)
+			require.True(t, field.Valid(), name)
+			assert.Equal(t, value.Type(), field.Type(), name)
+			assert.Equal(t, value, field.Eval(cell), name)
+		}
+		assert.False(t, compileFieldVar("cell.color").Valid())
+		assert.False(t, compileCoordinateVar("cell.energy").Valid())
+	})
+
+	t.Run("all fields are listed", func(t *testing.T) {
+		fields := Fields()
+		assert.Len(t, fields, len(fieldRegistry))
+		assert.Equal(t, "cell.connected", fields[0].Name)
+		assert.Equal(t, TypeBool, fields[0].Type)
+	})
 }
@@ -1,7 +1,10 @@
 module github.com/codeuniversity/al-master
 
+go 1.12
+
 require (
 	github.com/codeuniversity/al-proto v0.0.0-20190421194752-6539c98f8ef4
+	github.com/golang/protobuf v1.2.0
 	github.com/gorilla/websocket v1.4.0
 	github.com/prometheus/client_golang v0.9.2
 	github.com/stretchr/testify v1.3.0
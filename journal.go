@@ -0,0 +1,173 @@
+package master
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	protobuf "github.com/golang/protobuf/proto"
+
+	"github.com/codeuniversity/al-proto"
+)
+
+//journalMagic starts every journal file
+const journalMagic = "ALJOURNAL1"
+
+//ErrJournalTruncated is returned if a journal ends in the middle of an entry, which happens if the master crashed
+var ErrJournalTruncated = errors.New("journal ends in the middle of an entry")
+
+//JournalEntryKind tells what happened to the batch of a JournalEntry
+type JournalEntryKind byte
+
+const (
+	//JournalEntrySent batches were sent to cis
+	JournalEntrySent JournalEntryKind = iota + 1
+	//JournalEntryReturned batches were returned by cis
+	JournalEntryReturned
+	//JournalEntryRollback marks that the step of the batch was rolled back,
+	//all batches from that time step on that were journaled before are void
+	JournalEntryRollback
+	//JournalEntryCommit marks that the step of the batch was merged. Only the batches of committed steps are replayed,
+	//batches that were dispatched early for a step that never finished are left out
+	JournalEntryCommit
+)
+
+//JournalEntry is one record of a Journal
+type JournalEntry struct {
+	Kind  JournalEntryKind
+	Batch *proto.CellComputeBatch
+}
+
+//Journal records every batch that is sent to and returned by cis, so a run can be replayed later.
+//Each entry is stored as kind byte, uvarint length and the protobuf encoded CellComputeBatch
+type Journal struct {
+	file   *os.File
+	writer *bufio.Writer
+	lock   *sync.Mutex
+}
+
+//CreateJournal at path, overwriting an existing file
+func CreateJournal(path string, bucketWidth int) (*Journal, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	j := &Journal{
+		file:   file,
+		writer: bufio.NewWriter(file),
+		lock:   &sync.Mutex{},
+	}
+
+	header := make([]byte, len(journalMagic)+binary.MaxVarintLen64)
+	copy(header, journalMagic)
+	n := binary.PutUvarint(header[len(journalMagic):], uint64(bucketWidth))
+	if _, err := j.writer.Write(header[:len(journalMagic)+n]); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+//Record a batch. Safe to be called concurrently
+func (j *Journal) Record(kind JournalEntryKind, batch *proto.CellComputeBatch) error {
+	data, err := protobuf.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	prefix := make([]byte, 1+binary.MaxVarintLen64)
+	prefix[0] = byte(kind)
+	n := binary.PutUvarint(prefix[1:], uint64(len(data)))
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if _, err := j.writer.Write(prefix[:1+n]); err != nil {
+		return err
+	}
+	_, err = j.writer.Write(data)
+	return err
+}
+
+//Flush buffered entries to disk
+func (j *Journal) Flush() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	return j.writer.Flush()
+}
+
+//Close the journal after flushing it
+func (j *Journal) Close() error {
+	if err := j.Flush(); err != nil {
+		j.file.Close()
+		return err
+	}
+	return j.file.Close()
+}
+
+//JournalReader reads the entries of a journal one by one
+type JournalReader struct {
+	BucketWidth int
+
+	file   *os.File
+	reader *bufio.Reader
+}
+
+//OpenJournal at path and read its header
+func OpenJournal(path string) (*JournalReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader := bufio.NewReader(file)
+
+	magic := make([]byte, len(journalMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil || string(magic) != journalMagic {
+		file.Close()
+		return nil, fmt.Errorf("%v is not a journal", path)
+	}
+	bucketWidth, err := binary.ReadUvarint(reader)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return &JournalReader{BucketWidth: int(bucketWidth), file: file, reader: reader}, nil
+}
+
+//Next entry of the journal. Returns io.EOF after the last entry
+func (r *JournalReader) Next() (*JournalEntry, error) {
+	kind, err := r.reader.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length, err := binary.ReadUvarint(r.reader)
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r.reader, data); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	batch := &proto.CellComputeBatch{}
+	if err := protobuf.Unmarshal(data, batch); err != nil {
+		return nil, err
+	}
+	return &JournalEntry{Kind: JournalEntryKind(kind), Batch: batch}, nil
+}
+
+//Close the underlying file
+func (r *JournalReader) Close() error {
+	return r.file.Close()
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrJournalTruncated
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package master
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/codeuniversity/al-master/localcis"
+	"github.com/codeuniversity/al-proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const replayCISAddress = "journal"
+
+//ReplayClient answers cis calls with the batches that were returned in a journaled run,
+//so the evolution of the Buckets can be re-driven without any cis
+type ReplayClient struct {
+	BucketWidth   int
+	FirstTimeStep uint64
+	LastTimeStep  uint64
+
+	initialCells    []*proto.Cell
+	returnedBatches map[uint64]map[string]*proto.CellComputeBatch
+}
+
+//NewReplayClient from the journal at path
+func NewReplayClient(path string) (*ReplayClient, error) {
+	reader, err := OpenJournal(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	c := &ReplayClient{
+		BucketWidth:     reader.BucketWidth,
+		returnedBatches: map[uint64]map[string]*proto.CellComputeBatch{},
+	}
+	sentBatches := map[uint64][]*proto.CellComputeBatch{}
+	committedSteps := map[uint64]bool{}
+	for {
+		entry, err := reader.Next()
+		if err == io.EOF || err == ErrJournalTruncated {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		timeStep := entry.Batch.TimeStep
+		switch entry.Kind {
+		case JournalEntrySent:
+			sentBatches[timeStep] = append(sentBatches[timeStep], entry.Batch)
+		case JournalEntryReturned:
+			if c.returnedBatches[timeStep] == nil {
+				c.returnedBatches[timeStep] = map[string]*proto.CellComputeBatch{}
+			}
+			c.returnedBatches[timeStep][entry.Batch.BatchKey] = entry.Batch
+		case JournalEntryRollback:
+			for step := range c.returnedBatches {
+				if step >= timeStep {
+					delete(c.returnedBatches, step)
+				}
+			}
+		case JournalEntryCommit:
+			committedSteps[timeStep] = true
+		}
+	}
+	for step := range c.returnedBatches {
+		if !committedSteps[step] {
+			delete(c.returnedBatches, step)
+		}
+	}
+	if len(c.returnedBatches) == 0 {
+		return nil, errors.New("journal doesn't contain any committed steps")
+	}
+
+	first := true
+	for timeStep := range c.returnedBatches {
+		if first || timeStep < c.FirstTimeStep {
+			c.FirstTimeStep = timeStep
+		}
+		if first || timeStep > c.LastTimeStep {
+			c.LastTimeStep = timeStep
+		}
+		first = false
+	}
+
+	// every bucket of the first step is sent as a batch, so together they contain all cells
+	seenBuckets := map[string]bool{}
+	for _, batch := range sentBatches[c.FirstTimeStep] {
+		if seenBuckets[batch.BatchKey] {
+			continue
+		}
+		seenBuckets[batch.BatchKey] = true
+		c.initialCells = append(c.initialCells, batch.CellsToCompute...)
+	}
+
+	return c, nil
+}
+
+//InitialState the journaled run started with
+func (c *ReplayClient) InitialState() *SimulationState {
+	state := NewSimulationState(CreateBuckets(c.initialCells, uint(c.BucketWidth)))
+	state.CellBucketWidth = c.BucketWidth
+	state.TimeStep = c.FirstTimeStep
+	return state
+}
+
+//ComputeCellInteractions by looking up what cis returned for the batch
+func (c *ReplayClient) ComputeCellInteractions(ctx context.Context, batch *proto.CellComputeBatch, opts ...grpc.CallOption) (*proto.CellComputeBatch, error) {
+	returnedBatch, ok := c.returnedBatches[batch.TimeStep][batch.BatchKey]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "bucket %v of time step %v is not in the journal", batch.BatchKey, batch.TimeStep)
+	}
+	return returnedBatch, nil
+}
+
+//BigBang streams the cells the journaled run started with
+func (c *ReplayClient) BigBang(ctx context.Context, in *proto.BigBangRequest, opts ...grpc.CallOption) (proto.CellInteractionService_BigBangClient, error) {
+	return localcis.NewCellStream(ctx, c.initialCells), nil
+}
@@ -0,0 +1,156 @@
+package master
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codeuniversity/al-proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sentBatch := &proto.CellComputeBatch{
+		TimeStep:       3,
+		BatchKey:       "500/500/500",
+		CellsToCompute: []*proto.Cell{{Id: "1", Pos: &proto.Vector{X: 1, Y: 2, Z: 3}}},
+	}
+	returnedBatch := &proto.CellComputeBatch{
+		TimeStep:       3,
+		BatchKey:       "500/500/500",
+		CellsToCompute: []*proto.Cell{{Id: "1", Pos: &proto.Vector{X: 2, Y: 2, Z: 3}}},
+	}
+
+	t.Run("entries are read back in the order they were recorded", func(t *testing.T) {
+		path := filepath.Join(dir, "journal")
+		journal, err := CreateJournal(path, 500)
+		require.NoError(t, err)
+		require.NoError(t, journal.Record(JournalEntrySent, sentBatch))
+		require.NoError(t, journal.Record(JournalEntryReturned, returnedBatch))
+		require.NoError(t, journal.Close())
+
+		reader, err := OpenJournal(path)
+		require.NoError(t, err)
+		defer reader.Close()
+		assert.Equal(t, 500, reader.BucketWidth)
+
+		entry, err := reader.Next()
+		require.NoError(t, err)
+		assert.Equal(t, JournalEntrySent, entry.Kind)
+		assert.Equal(t, sentBatch.String(), entry.Batch.String())
+
+		entry, err = reader.Next()
+		require.NoError(t, err)
+		assert.Equal(t, JournalEntryReturned, entry.Kind)
+		assert.Equal(t, returnedBatch.String(), entry.Batch.String())
+
+		_, err = reader.Next()
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("a journal that was cut off in the middle of an entry is reported as truncated", func(t *testing.T) {
+		path := filepath.Join(dir, "truncated")
+		journal, err := CreateJournal(path, 500)
+		require.NoError(t, err)
+		require.NoError(t, journal.Record(JournalEntrySent, sentBatch))
+		require.NoError(t, journal.Close())
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.NoError(t, os.Truncate(path, info.Size()-3))
+
+		reader, err := OpenJournal(path)
+		require.NoError(t, err)
+		defer reader.Close()
+		_, err = reader.Next()
+		assert.Equal(t, ErrJournalTruncated, err)
+	})
+}
+
+func TestJournalReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal-replay-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	journalPath := filepath.Join(dir, "journal")
+
+	slave := startFakeSlave(t, 0)
+	defer slave.grpcServer.Stop()
+
+	config := testServerConfig()
+	config.JournalPath = journalPath
+	recording := startTestServer(t, config, slave)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, stepWithin(t, recording, stepDeadlockTimeout))
+	}
+	recording.closeConnections()
+
+	config = testServerConfig()
+	config.ReplayJournalPath = journalPath
+	replaying := startTestServer(t, config)
+	defer replaying.closeConnections()
+
+	assert.Equal(t, uint64(0), replaying.TimeStep)
+	assert.Equal(t, uint64(3), replaying.replayUntilTimeStep)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, stepWithin(t, replaying, stepDeadlockTimeout))
+	}
+
+	positions := func(s *Server) map[string]proto.Vector {
+		positions := map[string]proto.Vector{}
+		for _, cell := range s.CellBuckets.AllCells() {
+			positions[cell.Id] = proto.Vector{X: cell.Pos.X, Y: cell.Pos.Y, Z: cell.Pos.Z}
+		}
+		return positions
+	}
+	assert.Equal(t, recording.TimeStep, replaying.TimeStep)
+	assert.Equal(t, positions(recording), positions(replaying))
+}
+
+func TestJournalReplayAfterShutdownWithPredispatchedBatches(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal-replay-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	journalPath := filepath.Join(dir, "journal")
+
+	slave := startFakeSlave(t, 0)
+	defer slave.grpcServer.Stop()
+
+	config := testServerConfig()
+	config.JournalPath = journalPath
+	recording := startTestServer(t, config, slave)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, stepWithin(t, recording, stepDeadlockTimeout))
+	}
+	// the middle bucket was dispatched for time step 2 before step 1 finished, wait for it to be journaled
+	select {
+	case result := <-recording.CurrentReturnedBatchChan():
+		require.NoError(t, result.Err)
+		assert.Equal(t, uint64(2), result.Batch.TimeStep)
+	case <-time.After(stepDeadlockTimeout):
+		t.Fatal("no batch was dispatched early for time step 2")
+	}
+	recording.closeConnections()
+
+	replayClient, err := NewReplayClient(journalPath)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), replayClient.LastTimeStep, "time step 2 was never committed")
+
+	config = testServerConfig()
+	config.ReplayJournalPath = journalPath
+	replaying := startTestServer(t, config)
+	select {
+	case <-runInBackground(replaying):
+	case <-time.After(stepDeadlockTimeout):
+		t.Fatal("replay didn't stop at the end of the journal")
+	}
+	assert.Equal(t, recording.TimeStep, replaying.TimeStep)
+	assert.Equal(t, 0, replaying.summary.FailedSteps)
+}
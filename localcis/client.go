@@ -0,0 +1,195 @@
+//Package localcis is an in-process stand-in for cis, so the master can run without any cis instance or network.
+//
+//The rules are deliberately simple and deterministic:
+//every cell moves by its velocity and uses up one energy level per time step,
+//but regains it if another cell is within InteractionRadius. Cells without energy die.
+package localcis
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+
+	"github.com/codeuniversity/al-proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+//InteractionRadius in which cells keep each other alive
+const InteractionRadius = 50
+
+//maxSpawnSpeed is the maximum speed per axis a cell gets during the BigBang
+const maxSpawnSpeed = 5
+
+//Client computes cell interactions in-process and implements proto.CellInteractionServiceClient
+type Client struct {
+	seed int64
+}
+
+//NewClient whose BigBang spawns the same cells for the same seed
+func NewClient(seed int64) *Client {
+	return &Client{seed: seed}
+}
+
+//ComputeCellInteractions of the batch without mutating the cells that were sent
+func (c *Client) ComputeCellInteractions(ctx context.Context, batch *proto.CellComputeBatch, opts ...grpc.CallOption) (*proto.CellComputeBatch, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	computedCells := make([]*proto.Cell, 0, len(batch.CellsToCompute))
+	for _, cell := range batch.CellsToCompute {
+		energyLevel := cell.EnergyLevel
+		if !hasNeighbour(cell, batch.CellsToCompute, batch.CellsInProximity) && energyLevel > 0 {
+			energyLevel--
+		}
+		if energyLevel == 0 {
+			continue
+		}
+		computedCells = append(computedCells, &proto.Cell{
+			Id:          cell.Id,
+			EnergyLevel: energyLevel,
+			Pos:         add(cell.Pos, cell.Vel),
+			Vel:         copyVector(cell.Vel),
+			Dna:         cell.Dna,
+			Connections: cell.Connections,
+		})
+	}
+
+	return &proto.CellComputeBatch{
+		TimeStep:       batch.TimeStep,
+		CellsToCompute: computedCells,
+		BatchKey:       batch.BatchKey,
+	}, nil
+}
+
+//BigBang spawns the requested amount of cells inside the SpawnDimension.
+//Requests without a complete SpawnDimension or without a DnaLengthRange fail with InvalidArgument like they would in cis
+func (c *Client) BigBang(ctx context.Context, request *proto.BigBangRequest, opts ...grpc.CallOption) (proto.CellInteractionService_BigBangClient, error) {
+	if request.SpawnDimension == nil || request.SpawnDimension.Start == nil || request.SpawnDimension.End == nil {
+		return nil, status.Error(codes.InvalidArgument, "the big bang request needs a spawn dimension with start and end")
+	}
+	if request.DnaLengthRange == nil {
+		return nil, status.Error(codes.InvalidArgument, "the big bang request needs a dna length range")
+	}
+	rng := rand.New(rand.NewSource(c.seed))
+	start := request.SpawnDimension.Start
+	end := request.SpawnDimension.End
+	dnaRange := request.DnaLengthRange
+
+	cells := make([]*proto.Cell, 0, request.CellAmount)
+	for i := uint64(0); i < request.CellAmount; i++ {
+		dnaLength := dnaRange.Min
+		if dnaRange.Max > dnaRange.Min {
+			dnaLength += uint64(rng.Int63n(int64(dnaRange.Max - dnaRange.Min + 1)))
+		}
+		dna := make([]byte, dnaLength)
+		rng.Read(dna)
+
+		cells = append(cells, &proto.Cell{
+			Id:          fmt.Sprintf("%d", i),
+			EnergyLevel: request.EnergyLevel,
+			Pos: &proto.Vector{
+				X: between(rng, start.X, end.X),
+				Y: between(rng, start.Y, end.Y),
+				Z: between(rng, start.Z, end.Z),
+			},
+			Vel: &proto.Vector{
+				X: between(rng, -maxSpawnSpeed, maxSpawnSpeed),
+				Y: between(rng, -maxSpawnSpeed, maxSpawnSpeed),
+				Z: between(rng, -maxSpawnSpeed, maxSpawnSpeed),
+			},
+			Dna: dna,
+		})
+	}
+
+	return NewCellStream(ctx, cells), nil
+}
+
+func hasNeighbour(cell *proto.Cell, cellGroups ...[]*proto.Cell) bool {
+	for _, cells := range cellGroups {
+		for _, other := range cells {
+			if other.Id != cell.Id && distanceSquared(cell.Pos, other.Pos) <= InteractionRadius*InteractionRadius {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func distanceSquared(a, b *proto.Vector) float32 {
+	x, y, z := a.X-b.X, a.Y-b.Y, a.Z-b.Z
+	return x*x + y*y + z*z
+}
+
+func add(pos, vel *proto.Vector) *proto.Vector {
+	if vel == nil {
+		return copyVector(pos)
+	}
+	return &proto.Vector{X: pos.X + vel.X, Y: pos.Y + vel.Y, Z: pos.Z + vel.Z}
+}
+
+func copyVector(v *proto.Vector) *proto.Vector {
+	if v == nil {
+		return nil
+	}
+	return &proto.Vector{X: v.X, Y: v.Y, Z: v.Z}
+}
+
+func between(rng *rand.Rand, min, max float32) float32 {
+	return min + rng.Float32()*(max-min)
+}
+
+//NewCellStream hands out the given cells like the grpc stream of a BigBang would
+func NewCellStream(ctx context.Context, cells []*proto.Cell) proto.CellInteractionService_BigBangClient {
+	return &cellStream{ctx: ctx, cells: cells}
+}
+
+type cellStream struct {
+	ctx   context.Context
+	cells []*proto.Cell
+}
+
+func (s *cellStream) Recv() (*proto.Cell, error) {
+	if err := s.ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(s.cells) == 0 {
+		return nil, io.EOF
+	}
+	cell := s.cells[0]
+	s.cells = s.cells[1:]
+	return cell, nil
+}
+
+func (s *cellStream) Header() (metadata.MD, error) {
+	return metadata.MD{}, nil
+}
+
+func (s *cellStream) Trailer() metadata.MD {
+	return metadata.MD{}
+}
+
+func (s *cellStream) CloseSend() error {
+	return nil
+}
+
+func (s *cellStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *cellStream) SendMsg(m interface{}) error {
+	return nil
+}
+
+func (s *cellStream) RecvMsg(m interface{}) error {
+	cell, err := s.Recv()
+	if err != nil {
+		return err
+	}
+	*(m.(*proto.Cell)) = *cell
+	return nil
+}
@@ -0,0 +1,100 @@
+package localcis
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/codeuniversity/al-proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func receiveAll(t *testing.T, stream proto.CellInteractionService_BigBangClient) []*proto.Cell {
+	cells := []*proto.Cell{}
+	for {
+		cell, err := stream.Recv()
+		if err == io.EOF {
+			return cells
+		}
+		require.NoError(t, err)
+		cells = append(cells, cell)
+	}
+}
+
+func TestBigBang(t *testing.T) {
+	request := &proto.BigBangRequest{
+		SpawnDimension: &proto.SpawnDimension{
+			Start: &proto.Vector{X: 0, Y: 0, Z: 0},
+			End:   &proto.Vector{X: 100, Y: 200, Z: 300},
+		},
+		EnergyLevel:    20,
+		CellAmount:     500,
+		DnaLengthRange: &proto.DnaLengthRange{Min: 3, Max: 6},
+	}
+
+	t.Run("spawns the requested cells inside the spawn dimension", func(t *testing.T) {
+		stream, err := NewClient(1).BigBang(context.Background(), request)
+		require.NoError(t, err)
+		cells := receiveAll(t, stream)
+
+		assert.Len(t, cells, 500)
+		for _, cell := range cells {
+			assert.True(t, cell.Pos.X >= 0 && cell.Pos.X <= 100)
+			assert.True(t, cell.Pos.Y >= 0 && cell.Pos.Y <= 200)
+			assert.True(t, cell.Pos.Z >= 0 && cell.Pos.Z <= 300)
+			assert.True(t, len(cell.Dna) >= 3 && len(cell.Dna) <= 6)
+			assert.Equal(t, uint64(20), cell.EnergyLevel)
+		}
+	})
+
+	t.Run("spawns the same cells for the same seed", func(t *testing.T) {
+		firstStream, err := NewClient(42).BigBang(context.Background(), request)
+		require.NoError(t, err)
+		secondStream, err := NewClient(42).BigBang(context.Background(), request)
+		require.NoError(t, err)
+
+		assert.Equal(t, receiveAll(t, firstStream), receiveAll(t, secondStream))
+	})
+
+	t.Run("incomplete requests fail instead of panicking", func(t *testing.T) {
+		for _, incomplete := range []*proto.BigBangRequest{
+			{CellAmount: 1, DnaLengthRange: request.DnaLengthRange},
+			{CellAmount: 1, DnaLengthRange: request.DnaLengthRange, SpawnDimension: &proto.SpawnDimension{Start: &proto.Vector{}}},
+			{CellAmount: 1, SpawnDimension: request.SpawnDimension},
+		} {
+			stream, err := NewClient(1).BigBang(context.Background(), incomplete)
+			assert.Nil(t, stream)
+			assert.Equal(t, codes.InvalidArgument, status.Code(err), "%v", incomplete)
+		}
+	})
+}
+
+func TestComputeCellInteractions(t *testing.T) {
+	loner := &proto.Cell{Id: "loner", EnergyLevel: 5, Pos: &proto.Vector{X: 1000}, Vel: &proto.Vector{X: 1, Y: 2, Z: 3}}
+	dying := &proto.Cell{Id: "dying", EnergyLevel: 1, Pos: &proto.Vector{X: -1000}}
+	clustered := &proto.Cell{Id: "clustered", EnergyLevel: 5, Pos: &proto.Vector{}}
+	neighbour := &proto.Cell{Id: "neighbour", EnergyLevel: 5, Pos: &proto.Vector{X: 10}}
+	batch := &proto.CellComputeBatch{
+		TimeStep:         3,
+		BatchKey:         "0/0/0",
+		CellsToCompute:   []*proto.Cell{loner, dying, clustered},
+		CellsInProximity: []*proto.Cell{neighbour},
+	}
+
+	returnedBatch, err := NewClient(1).ComputeCellInteractions(context.Background(), batch)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(3), returnedBatch.TimeStep)
+	assert.Equal(t, "0/0/0", returnedBatch.BatchKey)
+	require.Len(t, returnedBatch.CellsToCompute, 2)
+
+	movedLoner := returnedBatch.CellsToCompute[0]
+	assert.Equal(t, &proto.Vector{X: 1001, Y: 2, Z: 3}, movedLoner.Pos)
+	assert.Equal(t, uint64(4), movedLoner.EnergyLevel)
+	assert.Equal(t, uint64(5), returnedBatch.CellsToCompute[1].EnergyLevel)
+
+	assert.Equal(t, &proto.Vector{X: 1000}, loner.Pos, "cells that were sent must not be mutated")
+}
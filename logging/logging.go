@@ -0,0 +1,251 @@
+//Package logging is a small structured, leveled logger.
+//
+//Every Logger belongs to a component, e.g. "server" or "websocket", whose minimum level can be configured separately.
+//Records are written as JSON objects or as human readable text lines, each with the fields attached through With.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Level of a record, records below the level of their component are dropped
+type Level int
+
+//Levels in increasing severity
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < DebugLevel || l > ErrorLevel {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+//ParseLevel of its name: debug, info, warn or error
+func ParseLevel(name string) (Level, error) {
+	for level, levelName := range levelNames {
+		if strings.EqualFold(name, levelName) {
+			return Level(level), nil
+		}
+	}
+	return InfoLevel, fmt.Errorf("unknown log level %q, use debug, info, warn or error", name)
+}
+
+//ParseComponentLevels of the form "server=debug,websocket=warn"
+func ParseComponentLevels(value string) (map[string]Level, error) {
+	levels := map[string]Level{}
+	if value == "" {
+		return levels, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("%q isn't of the form component=level", pair)
+		}
+		level, err := ParseLevel(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		levels[parts[0]] = level
+	}
+	return levels, nil
+}
+
+//Formats records can be written in
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+//Config of all loggers
+type Config struct {
+	//Output defaults to stderr
+	Output io.Writer
+	//Format is FormatText or FormatJSON
+	Format string
+	//Level of all components without an entry in ComponentLevels
+	Level           Level
+	ComponentLevels map[string]Level
+}
+
+var (
+	config     = Config{Output: os.Stderr, Format: FormatText, Level: InfoLevel}
+	configLock = &sync.RWMutex{}
+	//writeLock keeps records of concurrent loggers from interleaving
+	writeLock = &sync.Mutex{}
+)
+
+//Configure all loggers, including the ones that were created before
+func Configure(c Config) error {
+	if c.Format == "" {
+		c.Format = FormatText
+	}
+	if c.Format != FormatText && c.Format != FormatJSON {
+		return fmt.Errorf("unknown log format %q, use %v or %v", c.Format, FormatText, FormatJSON)
+	}
+	if c.Output == nil {
+		c.Output = os.Stderr
+	}
+	configLock.Lock()
+	config = c
+	configLock.Unlock()
+	return nil
+}
+
+func currentConfig() Config {
+	configLock.RLock()
+	defer configLock.RUnlock()
+	return config
+}
+
+//field is a key value pair attached to every record of a Logger
+type field struct {
+	key   string
+	value interface{}
+}
+
+//Logger writes records of one component. It is immutable, With returns a new Logger
+type Logger struct {
+	component string
+	fields    []field
+}
+
+//For returns the Logger of component
+func For(component string) *Logger {
+	return &Logger{component: component}
+}
+
+//With returns a Logger that adds the field to all of its records
+func (l *Logger) With(key string, value interface{}) *Logger {
+	fields := make([]field, len(l.fields), len(l.fields)+1)
+	copy(fields, l.fields)
+	return &Logger{component: l.component, fields: append(fields, field{key: key, value: value})}
+}
+
+//WithError returns a Logger that adds err as "error" field to all of its records
+func (l *Logger) WithError(err error) *Logger {
+	if err == nil {
+		return l
+	}
+	return l.With("error", err.Error())
+}
+
+//Enabled if records of level are written, to avoid computing fields that would be dropped
+func (l *Logger) Enabled(level Level) bool {
+	c := currentConfig()
+	return level >= levelOf(c, l.component)
+}
+
+//Debug logs details only needed when looking into a problem
+func (l *Logger) Debug(msg string) {
+	l.log(DebugLevel, msg)
+}
+
+//Info logs the normal course of the simulation
+func (l *Logger) Info(msg string) {
+	l.log(InfoLevel, msg)
+}
+
+//Warn logs problems the simulation recovers from
+func (l *Logger) Warn(msg string) {
+	l.log(WarnLevel, msg)
+}
+
+//Error logs problems the simulation can't recover from
+func (l *Logger) Error(msg string) {
+	l.log(ErrorLevel, msg)
+}
+
+//Fatal logs msg as error and exits the process
+func (l *Logger) Fatal(msg string) {
+	l.log(ErrorLevel, msg)
+	os.Exit(1)
+}
+
+func levelOf(c Config, component string) Level {
+	if level, ok := c.ComponentLevels[component]; ok {
+		return level
+	}
+	return c.Level
+}
+
+func (l *Logger) log(level Level, msg string) {
+	c := currentConfig()
+	if level < levelOf(c, l.component) {
+		return
+	}
+
+	var record []byte
+	if c.Format == FormatJSON {
+		record = l.jsonRecord(time.Now(), level, msg)
+	} else {
+		record = l.textRecord(time.Now(), level, msg)
+	}
+	writeLock.Lock()
+	c.Output.Write(record)
+	writeLock.Unlock()
+}
+
+//jsonRecord is a JSON object with time, level, component, msg and the fields of the logger.
+//Fields can't overwrite these keys
+func (l *Logger) jsonRecord(now time.Time, level Level, msg string) []byte {
+	record := map[string]interface{}{}
+	for _, f := range l.fields {
+		record[f.key] = jsonValue(f.value)
+	}
+	record["time"] = now.Format(time.RFC3339Nano)
+	record["level"] = level.String()
+	record["component"] = l.component
+	record["msg"] = msg
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		data, _ = json.Marshal(map[string]interface{}{
+			"time":      record["time"],
+			"level":     record["level"],
+			"component": l.component,
+			"msg":       msg,
+			"error":     "fields couldn't be encoded: " + err.Error(),
+		})
+	}
+	return append(data, '\n')
+}
+
+//jsonValue keeps values that can't be encoded as JSON, like errors, readable
+func jsonValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return value
+}
+
+//textRecord is a line like "2019-03-01T12:00:00Z INFO  server: step finished time_step=3 cell_count=20"
+func (l *Logger) textRecord(now time.Time, level Level, msg string) []byte {
+	builder := &strings.Builder{}
+	fmt.Fprintf(builder, "%v %-5v %v: %v", now.Format(time.RFC3339), strings.ToUpper(level.String()), l.component, msg)
+	for _, f := range l.fields {
+		value := fmt.Sprint(f.value)
+		if strings.ContainsAny(value, " \"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(builder, " %v=%v", f.key, value)
+	}
+	builder.WriteByte('\n')
+	return []byte(builder.String())
+}
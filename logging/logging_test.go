@@ -0,0 +1,93 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func configureForTest(t *testing.T, c Config) *bytes.Buffer {
+	output := &bytes.Buffer{}
+	c.Output = output
+	require.NoError(t, Configure(c))
+	return output
+}
+
+func resetConfig() {
+	Configure(Config{})
+}
+
+func TestJSONRecords(t *testing.T) {
+	defer resetConfig()
+	output := configureForTest(t, Config{Format: FormatJSON, Level: InfoLevel})
+
+	logger := For("server").With("time_step", 3).With("bucket_key", "1/2/3")
+	logger.WithError(errors.New("cis is failing")).With("msg", "can't overwrite").Warn("step aborted")
+
+	record := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(output.Bytes(), &record))
+	assert.Equal(t, "warn", record["level"])
+	assert.Equal(t, "server", record["component"])
+	assert.Equal(t, "step aborted", record["msg"])
+	assert.Equal(t, float64(3), record["time_step"])
+	assert.Equal(t, "1/2/3", record["bucket_key"])
+	assert.Equal(t, "cis is failing", record["error"])
+	assert.Contains(t, record, "time")
+
+	output.Reset()
+	logger.Info("step finished")
+	require.NoError(t, json.Unmarshal(output.Bytes(), &record))
+	assert.NotContains(t, output.String(), "cis is failing", "With doesn't change the logger it is called on")
+}
+
+func TestTextRecords(t *testing.T) {
+	defer resetConfig()
+	output := configureForTest(t, Config{Format: FormatText, Level: DebugLevel})
+
+	For("websocket").With("remote_address", "127.0.0.1:5000").With("reason", "going away").Debug("removing connection")
+
+	line := output.String()
+	assert.True(t, strings.HasSuffix(line, ` DEBUG websocket: removing connection remote_address=127.0.0.1:5000 reason="going away"`+"\n"), line)
+}
+
+func TestLevels(t *testing.T) {
+	defer resetConfig()
+	output := configureForTest(t, Config{
+		Format:          FormatJSON,
+		Level:           WarnLevel,
+		ComponentLevels: map[string]Level{"server": DebugLevel, "websocket": ErrorLevel},
+	})
+
+	For("server").Debug("server debug")
+	For("websocket").Warn("websocket warn")
+	For("state").Info("state info")
+	For("state").Error("state error")
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0], "server debug")
+	assert.Contains(t, lines[1], "state error")
+	assert.True(t, For("server").Enabled(DebugLevel))
+	assert.False(t, For("websocket").Enabled(WarnLevel))
+}
+
+func TestParseComponentLevels(t *testing.T) {
+	levels, err := ParseComponentLevels("server=debug,websocket=WARN")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Level{"server": DebugLevel, "websocket": WarnLevel}, levels)
+
+	levels, err = ParseComponentLevels("")
+	require.NoError(t, err)
+	assert.Empty(t, levels)
+
+	for _, value := range []string{"server", "=debug", "server=loud"} {
+		_, err := ParseComponentLevels(value)
+		assert.Error(t, err, value)
+	}
+	assert.Error(t, Configure(Config{Format: "xml"}))
+}
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"log"
 	_ "net/http/pprof"
+	"os"
+	"path"
+	"time"
 
 	"github.com/codeuniversity/al-master"
+	"github.com/codeuniversity/al-master/filters"
+	"github.com/codeuniversity/al-master/logging"
+	"github.com/codeuniversity/al-master/tracing"
 )
 
 const (
@@ -15,10 +22,18 @@ const (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "states" {
+		if err := runStatesCommand(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	config := master.ServerConfig{
 		ConnBufferSize: bufferSize,
 		GRPCPort:       grpcPort,
 		HTTPPort:       httpPort,
+		RetryPolicy:    master.DefaultRetryPolicy(),
 	}
 
 	flag.StringVar(&config.StateFileName, "state_from_file", "", "input the state name you want to load")
@@ -30,14 +45,190 @@ func main() {
 	)
 	flag.StringVar(&config.BigBangConfigPath, "big_bang_config_path", "./big_bang_config.yaml", "Path to the Big-Bang Config")
 	flag.IntVar(&config.BucketWidth, "bucket_width", 500, "defines the edge length of a bucket")
+	flag.StringVar(&config.StatesDir, "states_dir", master.DefaultStatesDir, "folder the states of all runs are saved in")
+	flag.StringVar(
+		&config.RunName,
+		"run_name",
+		"",
+		"name of the run, its states and metadata are saved in a folder of that name in -states_dir",
+	)
+	flag.DurationVar(
+		&config.HealthCheckInterval,
+		"health_check_interval",
+		5*time.Second,
+		"how often cis slaves are health checked, failing slaves get evicted until they recover",
+	)
+	flag.IntVar(
+		&config.RetryPolicy.MaxAttempts,
+		"cis_max_attempts",
+		config.RetryPolicy.MaxAttempts,
+		"how often a batch is tried before its time step is aborted and rolled back",
+	)
+	flag.DurationVar(&config.RetryPolicy.InitialBackoff, "cis_initial_backoff", config.RetryPolicy.InitialBackoff, "wait before the first retry of a batch, doubles with every retry")
+	flag.DurationVar(&config.RetryPolicy.MaxBackoff, "cis_max_backoff", config.RetryPolicy.MaxBackoff, "upper bound of the wait between retries of a batch")
+	flag.DurationVar(&config.RetryPolicy.AttemptTimeout, "cis_call_timeout", config.RetryPolicy.AttemptTimeout, "timeout of a single call to cis")
+	flag.DurationVar(
+		&config.RetryPolicy.ClientWaitTimeout,
+		"cis_client_wait_timeout",
+		config.RetryPolicy.ClientWaitTimeout,
+		"how long an attempt waits for a free cis client before it fails",
+	)
+	flag.DurationVar(
+		&config.ShutdownGracePeriod,
+		"shutdown_grace_period",
+		10*time.Second,
+		"time a running step gets to finish after SIGINT or SIGTERM before its cis calls are cancelled, a second signal exits right away",
+	)
+	flag.Float64Var(
+		&config.TargetTickRate,
+		"target_tick_rate",
+		0,
+		"time steps per second the simulation is throttled to, 0 is unlimited. Can be changed with POST /control/rate",
+	)
+	flag.IntVar(
+		&config.LocalCISThreads,
+		"local_cis_threads",
+		0,
+		"amount of in-process cis clients, set it to run the master without any cis instance",
+	)
+	flag.Int64Var(&config.LocalCISSeed, "local_cis_seed", 0, "seed of the BigBang of the in-process cis")
+	flag.StringVar(&config.JournalPath, "journal", "", "record every batch sent to and returned by cis into this file")
+	flag.StringVar(
+		&config.ReplayJournalPath,
+		"replay_journal",
+		"",
+		"replay the run recorded in this journal instead of asking cis",
+	)
+	flag.Uint64Var(&config.CheckpointEverySteps, "checkpoint_every_steps", 0, "save the state every n time steps, 0 disables it")
+	flag.DurationVar(&config.CheckpointInterval, "checkpoint_interval", 0, "save the state every interval, 0 disables it")
+	flag.IntVar(&config.CheckpointRetention, "checkpoint_retention", 0, "amount of saved states to keep, 0 keeps all of them. Without -run_name only the states saved by this run are removed")
+	flag.Uint64Var(&config.StopConditions.MaxTimeStep, "stop_at_time_step", 0, "stop once this time step is reached, 0 disables it")
+	flag.DurationVar(&config.StopConditions.MaxWallClock, "stop_after", 0, "stop after running this long, 0 disables it")
+	flag.IntVar(&config.StopConditions.MinCells, "stop_below_cells", 0, "stop once fewer cells are alive, 0 disables it")
+	flag.IntVar(&config.StopConditions.MaxCells, "stop_above_cells", 0, "stop once more cells are alive, 0 disables it")
+	noCellMatches := flag.String(
+		"stop_when_no_cell_matches",
+		"",
+		`stop once no cell passes these filters, given as JSON array like [{"left_hand":"cell.pos.x","left_hand_type":"coordinate","operator":"<","right_hand":"100","right_hand_type":"number"}]`,
+	)
+	flag.StringVar(
+		&config.PopulationStatsPath,
+		"population_stats",
+		"",
+		"append population statistics of every time step to this file, as CSV if it ends with .csv and as JSON lines otherwise",
+	)
+	stateStore := flag.String("state_store", "file", "where states are saved: file saves them in -states_dir, s3 in -s3_bucket")
+	s3Config := master.S3Config{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+	}
+	flag.StringVar(&s3Config.Endpoint, "s3_endpoint", "https://s3.amazonaws.com", "endpoint of the s3 compatible storage")
+	flag.StringVar(&s3Config.Region, "s3_region", "us-east-1", "region of -s3_bucket")
+	flag.StringVar(&s3Config.Bucket, "s3_bucket", "", "bucket states are saved in with -state_store s3")
+	flag.StringVar(&s3Config.Prefix, "s3_prefix", "states", "prefix of the state objects, followed by -run_name")
+	migrateStates := flag.Bool(
+		"migrate_states",
+		false,
+		"rewrite legacy gob state files in the current state format using -bucket_width and exit",
+	)
 
+	traceFile := flag.String("trace_file", "", "append tracing spans of every step as JSON lines to this file")
+	traceOTLPEndpoint := flag.String("trace_otlp_endpoint", "", "post tracing spans as OTLP/JSON to this collector url, e.g. http://localhost:4318/v1/traces")
+	logFormat := flag.String("log_format", logging.FormatText, "format of the log records: text or json")
+	logLevel := flag.String("log_level", "info", "minimum level of the log records: debug, info, warn or error")
+	componentLogLevels := flag.String(
+		"log_levels",
+		"",
+		"minimum log levels of single components overriding -log_level, e.g. server=debug,websocket=warn",
+	)
 	flag.Parse()
 
+	configureLogging(*logFormat, *logLevel, *componentLogLevels)
+	if *noCellMatches != "" {
+		if err := json.Unmarshal([]byte(*noCellMatches), &config.StopConditions.NoCellMatches); err != nil {
+			log.Fatal("-stop_when_no_cell_matches is no JSON array of filters: ", err)
+		}
+		if problems := filters.SetFromDefinitions(config.StopConditions.NoCellMatches).Problems(); len(problems) > 0 {
+			log.Fatal("-stop_when_no_cell_matches has invalid filters: ", problems)
+		}
+	}
+	if config.RetryPolicy.MaxAttempts < 1 {
+		log.Fatal("-cis_max_attempts has to be at least 1")
+	}
+	if config.RetryPolicy.AttemptTimeout <= 0 || config.RetryPolicy.ClientWaitTimeout <= 0 {
+		log.Fatal("-cis_call_timeout and -cis_client_wait_timeout have to be positive")
+	}
+	if config.RetryPolicy.InitialBackoff <= 0 || config.RetryPolicy.MaxBackoff <= 0 {
+		log.Fatal("-cis_initial_backoff and -cis_max_backoff have to be positive")
+	}
+	if err := master.ValidateTickRate(config.TargetTickRate); err != nil {
+		log.Fatal("-target_tick_rate is invalid: ", err)
+	}
+	if err := master.ValidateRunName(config.RunName); err != nil {
+		log.Fatal(err)
+	}
+	switch *stateStore {
+	case "file":
+	case "s3":
+		if s3Config.Bucket == "" {
+			log.Fatal("-state_store s3 needs -s3_bucket")
+		}
+		s3Config.Prefix = path.Join(s3Config.Prefix, config.RunName)
+		config.StateStore = master.NewS3StateStore(s3Config)
+	default:
+		log.Fatalf("unknown -state_store %v, use file or s3", *stateStore)
+	}
+	if *migrateStates {
+		migratedFiles, err := master.MigrateStates(config.StatesFolder(), config.BucketWidth)
+		for _, name := range migratedFiles {
+			logging.For("state").With("state", name).Info("migrated")
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	if config.StateFileName != "" && config.LoadLatestState {
 		log.Fatal("You shouldn't use the flags -state_from_file and -load_latest_state at the same time")
 	}
+	if config.ReplayJournalPath != "" && (config.StateFileName != "" || config.LoadLatestState || config.JournalPath != "") {
+		log.Fatal("-replay_journal can't be combined with loading a state or recording a journal")
+	}
+
+	switch {
+	case *traceFile != "" && *traceOTLPEndpoint != "":
+		log.Fatal("-trace_file and -trace_otlp_endpoint can't be combined")
+	case *traceFile != "":
+		exporter, err := tracing.NewFileExporter(*traceFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		config.TraceExporter = exporter
+	case *traceOTLPEndpoint != "":
+		config.TraceExporter = tracing.NewOTLPExporter(*traceOTLPEndpoint, "al-master", 5*time.Second)
+	}
 
 	s := master.NewServer(config)
 	s.Init()
 	s.Run()
 }
+
+func configureLogging(format, level, componentLevels string) {
+	defaultLevel, err := logging.ParseLevel(level)
+	if err != nil {
+		log.Fatal(err)
+	}
+	levels, err := logging.ParseComponentLevels(componentLevels)
+	if err != nil {
+		log.Fatal("-log_levels: ", err)
+	}
+	err = logging.Configure(logging.Config{
+		Output:          os.Stderr,
+		Format:          format,
+		Level:           defaultLevel,
+		ComponentLevels: levels,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codeuniversity/al-master"
+	"github.com/codeuniversity/al-proto"
+)
+
+const statesUsage = `usage: master states [-states_dir dir] [-run_name name] <command>
+
+commands:
+  runs                                       named runs with their start time
+  list                                       time step, cell count, buckets and file size of every state
+  inspect [-bins n] [name]                   energy and dna length histograms and bounding box of a state
+  diff <from> <to>                           cells added, removed and changed between two states
+  export [-format json|csv] [-o path] [name]  all cells of a state
+
+name defaults to the latest state.
+`
+
+//runStatesCommand runs the states subcommand with the arguments following "states"
+func runStatesCommand(args []string) error {
+	flags := flag.NewFlagSet("states", flag.ExitOnError)
+	statesDir := flags.String("states_dir", master.DefaultStatesDir, "folder the states of all runs are saved in")
+	runName := flags.String("run_name", "", "run whose states are used")
+	flags.Parse(args)
+	if err := master.ValidateRunName(*runName); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		return errors.New(statesUsage)
+	}
+	folder := master.RunFolder(*statesDir, *runName)
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "runs":
+		return listRuns(os.Stdout, *statesDir)
+	case "list":
+		return listStates(os.Stdout, folder)
+	case "inspect":
+		flags := flag.NewFlagSet("inspect", flag.ExitOnError)
+		bins := flags.Int("bins", 10, "maximum amount of bins of the histograms")
+		flags.Parse(args)
+		state, err := loadState(folder, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		return printJSON(os.Stdout, state.CellBuckets.Statistics(*bins))
+	case "diff":
+		if len(args) != 2 {
+			return errors.New(statesUsage)
+		}
+		from, err := loadState(folder, args[0])
+		if err != nil {
+			return err
+		}
+		to, err := loadState(folder, args[1])
+		if err != nil {
+			return err
+		}
+		return printJSON(os.Stdout, master.DiffStates(from, to))
+	case "export":
+		flags := flag.NewFlagSet("export", flag.ExitOnError)
+		format := flags.String("format", "json", "json or csv")
+		outputPath := flags.String("o", "", "file to write to instead of stdout")
+		flags.Parse(args)
+		state, err := loadState(folder, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		return exportState(state, *format, *outputPath)
+	}
+	return errors.New(statesUsage)
+}
+
+func listRuns(w io.Writer, statesDir string) error {
+	names, err := master.RunNames(statesDir)
+	if err != nil {
+		return err
+	}
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "RUN\tSTARTED AT\tSTATES")
+	for _, name := range names {
+		folder := master.RunFolder(statesDir, name)
+		metadata, err := master.ReadRunMetadata(folder)
+		if err != nil {
+			return err
+		}
+		stateNames, err := master.StateNames(folder)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(table, "%v\t%v\t%v\n", name, metadata.StartedAt.Format(time.RFC3339), len(stateNames))
+	}
+	return table.Flush()
+}
+
+func listStates(w io.Writer, folder string) error {
+	names, err := master.StateNames(folder)
+	if err != nil {
+		return err
+	}
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tTIME STEP\tCELLS\tBUCKETS\tSIZE\tFORMAT")
+	for _, name := range names {
+		path := filepath.Join(folder, name)
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		header, err := master.ReadStateHeader(path)
+		if err != nil {
+			fmt.Fprintf(table, "%v\t\t\t\t%v\tunreadable: %v\n", name, info.Size(), err)
+			continue
+		}
+		format := "legacy gob"
+		if header.FormatVersion > 0 {
+			format = fmt.Sprint("v", header.FormatVersion)
+		}
+		fmt.Fprintf(table, "%v\t%v\t%v\t%v\t%v\t%v\n", name, header.TimeStep, header.CellCount, header.BucketCount, info.Size(), format)
+	}
+	return table.Flush()
+}
+
+func loadState(folder, name string) (*master.SimulationState, error) {
+	if name == "" {
+		latestName, err := master.LatestStateName(folder)
+		if err != nil {
+			return nil, err
+		}
+		name = latestName
+	}
+	return master.LoadSimulationState(filepath.Join(folder, name))
+}
+
+func exportState(state *master.SimulationState, format, outputPath string) error {
+	var w io.Writer = os.Stdout
+	if outputPath != "" {
+		file, err := os.Create(outputPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		w = file
+	}
+
+	switch format {
+	case "json":
+		return exportJSON(w, state)
+	case "csv":
+		return exportCSV(w, state)
+	}
+	return fmt.Errorf("unknown export format %v, use json or csv", format)
+}
+
+//exportJSON writes an array of the cells, one cell per line
+func exportJSON(w io.Writer, state *master.SimulationState) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	separator := "\n"
+	for _, cells := range state.CellBuckets {
+		for _, cell := range cells {
+			data, err := json.Marshal(cell)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "%v%s", separator, data); err != nil {
+				return err
+			}
+			separator = ",\n"
+		}
+	}
+	_, err := io.WriteString(w, "\n]\n")
+	return err
+}
+
+func exportCSV(w io.Writer, state *master.SimulationState) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"id", "energy_level", "pos_x", "pos_y", "pos_z", "vel_x", "vel_y", "vel_z", "dna_length", "dna_hex", "connections"})
+	for _, cells := range state.CellBuckets {
+		for _, cell := range cells {
+			pos, vel := vectorOrZero(cell.Pos), vectorOrZero(cell.Vel)
+			writer.Write([]string{
+				cell.Id,
+				strconv.FormatUint(cell.EnergyLevel, 10),
+				formatFloat(pos.X), formatFloat(pos.Y), formatFloat(pos.Z),
+				formatFloat(vel.X), formatFloat(vel.Y), formatFloat(vel.Z),
+				strconv.Itoa(len(cell.Dna)),
+				hex.EncodeToString(cell.Dna),
+				strconv.Itoa(len(cell.Connections)),
+			})
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func printJSON(w io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+func vectorOrZero(vector *proto.Vector) *proto.Vector {
+	if vector == nil {
+		return &proto.Vector{}
+	}
+	return vector
+}
+
+func formatFloat(value float32) string {
+	return strconv.FormatFloat(float64(value), 'g', -1, 32)
+}
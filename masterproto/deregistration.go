@@ -0,0 +1,101 @@
+//Package masterproto holds grpc services of the master that are not part of al-proto yet.
+//The types mirror what protoc-gen-go would generate from deregistration.proto,
+//so cis can talk to them with the regular protobuf wire format.
+package masterproto
+
+import (
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+//SlaveDeregistration is sent by a cis instance that is about to leave
+type SlaveDeregistration struct {
+	Address string `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+}
+
+//Reset ...
+func (m *SlaveDeregistration) Reset() { *m = SlaveDeregistration{} }
+
+//String ...
+func (m *SlaveDeregistration) String() string { return proto.CompactTextString(m) }
+
+//ProtoMessage ...
+func (*SlaveDeregistration) ProtoMessage() {}
+
+//SlaveDeregistrationResponse is returned once all inflight calls of the slave have finished
+type SlaveDeregistrationResponse struct{}
+
+//Reset ...
+func (m *SlaveDeregistrationResponse) Reset() { *m = SlaveDeregistrationResponse{} }
+
+//String ...
+func (m *SlaveDeregistrationResponse) String() string { return proto.CompactTextString(m) }
+
+//ProtoMessage ...
+func (*SlaveDeregistrationResponse) ProtoMessage() {}
+
+//SlaveDeregistrationServiceClient is the client API for SlaveDeregistrationService
+type SlaveDeregistrationServiceClient interface {
+	Deregister(ctx context.Context, in *SlaveDeregistration, opts ...grpc.CallOption) (*SlaveDeregistrationResponse, error)
+}
+
+type slaveDeregistrationServiceClient struct {
+	cc *grpc.ClientConn
+}
+
+//NewSlaveDeregistrationServiceClient ...
+func NewSlaveDeregistrationServiceClient(cc *grpc.ClientConn) SlaveDeregistrationServiceClient {
+	return &slaveDeregistrationServiceClient{cc}
+}
+
+func (c *slaveDeregistrationServiceClient) Deregister(ctx context.Context, in *SlaveDeregistration, opts ...grpc.CallOption) (*SlaveDeregistrationResponse, error) {
+	out := new(SlaveDeregistrationResponse)
+	err := c.cc.Invoke(ctx, "/masterproto.SlaveDeregistrationService/Deregister", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+//SlaveDeregistrationServiceServer is the server API for SlaveDeregistrationService
+type SlaveDeregistrationServiceServer interface {
+	Deregister(context.Context, *SlaveDeregistration) (*SlaveDeregistrationResponse, error)
+}
+
+//RegisterSlaveDeregistrationServiceServer ...
+func RegisterSlaveDeregistrationServiceServer(s *grpc.Server, srv SlaveDeregistrationServiceServer) {
+	s.RegisterService(&slaveDeregistrationServiceDesc, srv)
+}
+
+func slaveDeregistrationServiceDeregisterHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SlaveDeregistration)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SlaveDeregistrationServiceServer).Deregister(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/masterproto.SlaveDeregistrationService/Deregister",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SlaveDeregistrationServiceServer).Deregister(ctx, req.(*SlaveDeregistration))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+var slaveDeregistrationServiceDesc = grpc.ServiceDesc{
+	ServiceName: "masterproto.SlaveDeregistrationService",
+	HandlerType: (*SlaveDeregistrationServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Deregister",
+			Handler:    slaveDeregistrationServiceDeregisterHandler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "deregistration.proto",
+}
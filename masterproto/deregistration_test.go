@@ -0,0 +1,19 @@
+package masterproto
+
+import (
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlaveDeregistrationWireFormat(t *testing.T) {
+	data, err := proto.Marshal(&SlaveDeregistration{Address: "cis:3000"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x0a, 0x08, 'c', 'i', 's', ':', '3', '0', '0', '0'}, data)
+
+	decoded := &SlaveDeregistration{}
+	require.NoError(t, proto.Unmarshal(data, decoded))
+	assert.Equal(t, "cis:3000", decoded.Address)
+}
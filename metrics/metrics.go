@@ -47,6 +47,111 @@ var (
 		Name: "cis_client_count",
 		Help: "the number of used CIS clients",
 	})
+	//CISSlaveEvictionCounter, the number of times a CIS slave got evicted from the client pool
+	CISSlaveEvictionCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cis_slave_eviction_count",
+		Help: "the number of times a CIS slave got evicted from the client pool",
+	})
+	//StepRollbackCounter, the number of time steps that were aborted because a batch failed
+	StepRollbackCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "step_rollback_count",
+		Help: "the number of time steps that were aborted because a batch failed",
+	})
+	//CISCallRetryCounter, the number of times a call to a CIS instance was retried after a failed attempt
+	CISCallRetryCounter = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "cis_call_retry_count",
+		Help: "the number of times a call to a CIS instance was retried after a failed attempt",
+	})
+	//CISClientWaitSeconds, the amount of time a call is blocked waiting for a free CIS client in seconds
+	CISClientWaitSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "cis_client_wait_seconds",
+		Help:    "the amount of time a call is blocked waiting for a free CIS client in seconds",
+		Buckets: []float64{0.0001, 0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 5},
+	})
+
+	//StepDurationSeconds, the amount of time it takes to compute a time step in seconds
+	StepDurationSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "step_duration_seconds",
+		Help:    "the amount of time it takes to compute a time step in seconds",
+		Buckets: []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	})
+	//StepBatchCount, the number of batches a time step is computed in
+	StepBatchCount = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "step_batch_count",
+		Help:    "the number of batches a time step is computed in",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+	})
+	//StepPredispatchedBatchCount, the number of batches of the next time step that were dispatched
+	//while the time step was still being computed, because all of their neighbours were done
+	StepPredispatchedBatchCount = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "step_predispatched_batch_count",
+		Help:    "the number of batches of the next time step that were dispatched while the time step was still being computed",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+	})
+	//BatchCellsToCompute, the number of cells a batch lets a CIS instance compute
+	BatchCellsToCompute = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "batch_cells_to_compute",
+		Help:    "the number of cells a batch lets a CIS instance compute",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 16),
+	})
+	//BatchCellsInProximity, the number of surrounding cells a batch sends along with the cells to compute
+	BatchCellsInProximity = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "batch_cells_in_proximity",
+		Help:    "the number of surrounding cells a batch sends along with the cells to compute",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 18),
+	})
+
+	//TargetTickRate, the time steps per second the simulation is throttled to, 0 if it is unlimited
+	TargetTickRate = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "tick_rate_target",
+		Help: "the time steps per second the simulation is throttled to, 0 if it is unlimited",
+	})
+	//ActualTickRate, the time steps per second the simulation made over the last steps
+	ActualTickRate = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "tick_rate_actual",
+		Help: "the time steps per second the simulation made over the last steps",
+	})
+
+	//PopulationCellCount, the amount of cells alive in the current time step
+	PopulationCellCount = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "population_cell_count",
+		Help: "the amount of cells alive in the current time step",
+	})
+	//PopulationTotalEnergy, the summed energy level of all cells
+	PopulationTotalEnergy = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "population_energy_total",
+		Help: "the summed energy level of all cells",
+	})
+	//PopulationMeanEnergy, the mean energy level of the cells
+	PopulationMeanEnergy = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "population_energy_mean",
+		Help: "the mean energy level of the cells",
+	})
+	//PopulationMeanDnaLength, the mean dna length of the cells
+	PopulationMeanDnaLength = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "population_dna_length_mean",
+		Help: "the mean dna length of the cells",
+	})
+	//PopulationBirths, the amount of cell ids that appeared in the last time step
+	PopulationBirths = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "population_births",
+		Help: "the amount of cell ids that appeared in the last time step",
+	})
+	//PopulationDeaths, the amount of cell ids that disappeared in the last time step
+	PopulationDeaths = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "population_deaths",
+		Help: "the amount of cell ids that disappeared in the last time step",
+	})
+	//PopulationBoundingBoxMin, the lower corner of the box containing all cells per axis
+	PopulationBoundingBoxMin = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "population_bounding_box_min",
+		Help: "the lower corner of the box containing all cells per axis",
+	}, []string{"axis"})
+	//PopulationBoundingBoxMax, the upper corner of the box containing all cells per axis
+	PopulationBoundingBoxMax = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "population_bounding_box_max",
+		Help: "the upper corner of the box containing all cells per axis",
+	}, []string{"axis"})
 
 	//WebSocketConnectionsCount, the number of currently active websocket connections
 	WebSocketConnectionsCount = prometheus.NewGauge(prometheus.GaugeOpts{
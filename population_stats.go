@@ -0,0 +1,183 @@
+package master
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codeuniversity/al-master/metrics"
+)
+
+//PopulationStats aggregates the cells of one time step
+type PopulationStats struct {
+	TimeStep    uint64  `json:"time_step"`
+	CellCount   int     `json:"cell_count"`
+	TotalEnergy uint64  `json:"total_energy"`
+	MeanEnergy  float64 `json:"mean_energy"`
+	//DnaLength* describe the distribution of the dna lengths
+	DnaLengthMin    int     `json:"dna_length_min"`
+	DnaLengthMedian float64 `json:"dna_length_median"`
+	DnaLengthMean   float64 `json:"dna_length_mean"`
+	DnaLengthMax    int     `json:"dna_length_max"`
+	//Births and Deaths are the ids that appeared and disappeared since the previous time step
+	Births int `json:"births"`
+	Deaths int `json:"deaths"`
+	//BoundingBox is nil if there are no cells
+	BoundingBox *BoundingBox `json:"bounding_box,omitempty"`
+}
+
+var populationCSVHeader = []string{
+	"time_step", "cell_count", "total_energy", "mean_energy",
+	"dna_length_min", "dna_length_median", "dna_length_mean", "dna_length_max",
+	"births", "deaths",
+	"min_x", "min_y", "min_z", "max_x", "max_y", "max_z",
+}
+
+//populationTracker computes the PopulationStats of consecutive time steps
+type populationTracker struct {
+	//previousIDs are the ids of the cells of the previous time step, nil before the first one
+	previousIDs map[string]bool
+}
+
+//track the cells of the time step. Births and deaths are 0 for the first time step that is tracked
+func (p *populationTracker) track(timeStep uint64, buckets Buckets) *PopulationStats {
+	stats := &PopulationStats{TimeStep: timeStep}
+	ids := map[string]bool{}
+	dnaLengths := []int{}
+	totalDnaLength := 0
+	for _, cells := range buckets {
+		for _, cell := range cells {
+			ids[cell.Id] = true
+			stats.TotalEnergy += cell.EnergyLevel
+			dnaLengths = append(dnaLengths, len(cell.Dna))
+			totalDnaLength += len(cell.Dna)
+			stats.BoundingBox = stats.BoundingBox.extend(cell.Pos)
+			if p.previousIDs != nil && !p.previousIDs[cell.Id] {
+				stats.Births++
+			}
+		}
+	}
+	for id := range p.previousIDs {
+		if !ids[id] {
+			stats.Deaths++
+		}
+	}
+	p.previousIDs = ids
+
+	stats.CellCount = len(dnaLengths)
+	if stats.CellCount > 0 {
+		sort.Ints(dnaLengths)
+		stats.MeanEnergy = float64(stats.TotalEnergy) / float64(stats.CellCount)
+		stats.DnaLengthMin = dnaLengths[0]
+		stats.DnaLengthMax = dnaLengths[len(dnaLengths)-1]
+		stats.DnaLengthMean = float64(totalDnaLength) / float64(stats.CellCount)
+		middle := len(dnaLengths) / 2
+		stats.DnaLengthMedian = float64(dnaLengths[middle])
+		if len(dnaLengths)%2 == 0 {
+			stats.DnaLengthMedian = float64(dnaLengths[middle-1]+dnaLengths[middle]) / 2
+		}
+	}
+	return stats
+}
+
+//updatePopulationMetrics sets the prometheus population gauges
+func updatePopulationMetrics(stats *PopulationStats) {
+	metrics.PopulationCellCount.Set(float64(stats.CellCount))
+	metrics.PopulationTotalEnergy.Set(float64(stats.TotalEnergy))
+	metrics.PopulationMeanEnergy.Set(stats.MeanEnergy)
+	metrics.PopulationMeanDnaLength.Set(stats.DnaLengthMean)
+	metrics.PopulationBirths.Set(float64(stats.Births))
+	metrics.PopulationDeaths.Set(float64(stats.Deaths))
+	box := stats.BoundingBox
+	if box == nil {
+		box = &BoundingBox{}
+	}
+	for axis, values := range map[string][2]float32{
+		"x": {box.Min.X, box.Max.X},
+		"y": {box.Min.Y, box.Max.Y},
+		"z": {box.Min.Z, box.Max.Z},
+	} {
+		metrics.PopulationBoundingBoxMin.WithLabelValues(axis).Set(float64(values[0]))
+		metrics.PopulationBoundingBoxMax.WithLabelValues(axis).Set(float64(values[1]))
+	}
+}
+
+//PopulationStatsWriter appends PopulationStats to a CSV file if its path ends with .csv and to a JSON lines file otherwise
+type PopulationStatsWriter struct {
+	file   *os.File
+	writer *bufio.Writer
+	csv    *csv.Writer
+}
+
+//OpenPopulationStatsWriter appending to the file at path. A CSV header is written if the file is empty
+func OpenPopulationStatsWriter(path string) (*PopulationStatsWriter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	w := &PopulationStatsWriter{file: file, writer: bufio.NewWriter(file)}
+	if !strings.HasSuffix(path, ".csv") {
+		return w, nil
+	}
+
+	w.csv = csv.NewWriter(w.writer)
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if info.Size() == 0 {
+		w.csv.Write(populationCSVHeader)
+	}
+	return w, nil
+}
+
+//Write the stats of one time step and flush them to the file
+func (w *PopulationStatsWriter) Write(stats *PopulationStats) error {
+	if w.csv == nil {
+		data, err := json.Marshal(stats)
+		if err != nil {
+			return err
+		}
+		w.writer.Write(data)
+		w.writer.WriteByte('\n')
+		return w.writer.Flush()
+	}
+
+	box := stats.BoundingBox
+	if box == nil {
+		box = &BoundingBox{}
+	}
+	w.csv.Write([]string{
+		strconv.FormatUint(stats.TimeStep, 10),
+		strconv.Itoa(stats.CellCount),
+		strconv.FormatUint(stats.TotalEnergy, 10),
+		formatStatsFloat(stats.MeanEnergy),
+		strconv.Itoa(stats.DnaLengthMin),
+		formatStatsFloat(stats.DnaLengthMedian),
+		formatStatsFloat(stats.DnaLengthMean),
+		strconv.Itoa(stats.DnaLengthMax),
+		strconv.Itoa(stats.Births),
+		strconv.Itoa(stats.Deaths),
+		formatStatsFloat(float64(box.Min.X)), formatStatsFloat(float64(box.Min.Y)), formatStatsFloat(float64(box.Min.Z)),
+		formatStatsFloat(float64(box.Max.X)), formatStatsFloat(float64(box.Max.Y)), formatStatsFloat(float64(box.Max.Z)),
+	})
+	w.csv.Flush()
+	if err := w.csv.Error(); err != nil {
+		return err
+	}
+	return w.writer.Flush()
+}
+
+//Close the underlying file
+func (w *PopulationStatsWriter) Close() error {
+	return w.file.Close()
+}
+
+func formatStatsFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,87 @@
+package master
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/codeuniversity/al-proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPopulationTracker(t *testing.T) {
+	tracker := &populationTracker{}
+	first := tracker.track(1, CreateBuckets([]*proto.Cell{
+		{Id: "a", EnergyLevel: 2, Dna: []byte("AC"), Pos: &proto.Vector{X: -1, Y: 2, Z: 3}},
+		{Id: "b", EnergyLevel: 4, Dna: []byte("ACGT"), Pos: &proto.Vector{X: 5, Y: -6, Z: 7}},
+	}, 500))
+	assert.Equal(t, &PopulationStats{
+		TimeStep:        1,
+		CellCount:       2,
+		TotalEnergy:     6,
+		MeanEnergy:      3,
+		DnaLengthMin:    2,
+		DnaLengthMedian: 3,
+		DnaLengthMean:   3,
+		DnaLengthMax:    4,
+		BoundingBox:     &BoundingBox{Min: Vector{X: -1, Y: -6, Z: 3}, Max: Vector{X: 5, Y: 2, Z: 7}},
+	}, first)
+
+	second := tracker.track(2, CreateBuckets([]*proto.Cell{
+		{Id: "b", EnergyLevel: 3, Dna: []byte("ACGT"), Pos: &proto.Vector{}},
+		{Id: "c", EnergyLevel: 1, Dna: []byte("A"), Pos: &proto.Vector{}},
+		{Id: "d", EnergyLevel: 1, Dna: []byte("ACG"), Pos: &proto.Vector{}},
+	}, 500))
+	assert.Equal(t, 2, second.Births)
+	assert.Equal(t, 1, second.Deaths)
+	assert.Equal(t, float64(3), second.DnaLengthMedian)
+
+	empty := tracker.track(3, Buckets{})
+	assert.Equal(t, 0, empty.CellCount)
+	assert.Equal(t, 3, empty.Deaths)
+	assert.Nil(t, empty.BoundingBox)
+}
+
+func TestPopulationStatsWriter(t *testing.T) {
+	defer cleanup()
+	require.NoError(t, os.MkdirAll(testStatesFolderName, 0755))
+	stats := &PopulationStats{TimeStep: 4, CellCount: 2, TotalEnergy: 5, MeanEnergy: 2.5, Births: 1}
+
+	t.Run("csv with a single header", func(t *testing.T) {
+		path := filepath.Join(testStatesFolderName, "population.csv")
+		for i := 0; i < 2; i++ {
+			writer, err := OpenPopulationStatsWriter(path)
+			require.NoError(t, err)
+			require.NoError(t, writer.Write(stats))
+			require.NoError(t, writer.Close())
+		}
+
+		data, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		require.Len(t, lines, 3)
+		assert.Equal(t, strings.Join(populationCSVHeader, ","), lines[0])
+		assert.Equal(t, "4,2,5,2.5,0,0,0,0,1,0,0,0,0,0,0,0", lines[1])
+	})
+
+	t.Run("json lines", func(t *testing.T) {
+		path := filepath.Join(testStatesFolderName, "population.jsonl")
+		writer, err := OpenPopulationStatsWriter(path)
+		require.NoError(t, err)
+		require.NoError(t, writer.Write(stats))
+		require.NoError(t, writer.Write(stats))
+		require.NoError(t, writer.Close())
+
+		data, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		require.Len(t, lines, 2)
+		read := &PopulationStats{}
+		require.NoError(t, json.Unmarshal([]byte(lines[1]), read))
+		assert.Equal(t, stats, read)
+	})
+}
@@ -0,0 +1,76 @@
+package master
+
+import (
+	"fmt"
+	"time"
+)
+
+//RetryPolicy defines how often and how patiently a batch is retried before its step is given up
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	//AttemptTimeout bounds a single ComputeCellInteractions call
+	AttemptTimeout time.Duration
+	//ClientWaitTimeout bounds how long an attempt waits for a free client
+	ClientWaitTimeout time.Duration
+}
+
+//DefaultRetryPolicy is used if nothing else is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:       5,
+		InitialBackoff:    100 * time.Millisecond,
+		MaxBackoff:        5 * time.Second,
+		AttemptTimeout:    10 * time.Second,
+		ClientWaitTimeout: 30 * time.Second,
+	}
+}
+
+//withDefaults fills the fields that aren't set, or can't work like a zero MaxAttempts, from DefaultRetryPolicy
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	defaults := DefaultRetryPolicy()
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = defaults.MaxAttempts
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = defaults.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = defaults.MaxBackoff
+	}
+	if p.AttemptTimeout <= 0 {
+		p.AttemptTimeout = defaults.AttemptTimeout
+	}
+	if p.ClientWaitTimeout <= 0 {
+		p.ClientWaitTimeout = defaults.ClientWaitTimeout
+	}
+	return p
+}
+
+//Backoff to wait before the given retry, doubling with every retry up to MaxBackoff
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	backoff := p.InitialBackoff
+	for i := 1; i < retry; i++ {
+		backoff *= 2
+		if backoff >= p.MaxBackoff {
+			return p.MaxBackoff
+		}
+	}
+	if backoff > p.MaxBackoff {
+		return p.MaxBackoff
+	}
+	return backoff
+}
+
+//BatchFailedError is returned by a step if one of its batches couldn't be computed within the RetryPolicy
+type BatchFailedError struct {
+	BatchKey BucketKey
+	TimeStep uint64
+	Attempts int
+	Err      error
+}
+
+func (e *BatchFailedError) Error() string {
+	return fmt.Sprintf("batch %v of time step %v failed after %v attempts: %v", e.BatchKey, e.TimeStep, e.Attempts, e.Err)
+}
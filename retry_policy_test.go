@@ -0,0 +1,34 @@
+package master
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	t.Run("doubles with every retry", func(t *testing.T) {
+		assert.Equal(t, 100*time.Millisecond, policy.Backoff(1))
+		assert.Equal(t, 200*time.Millisecond, policy.Backoff(2))
+		assert.Equal(t, 400*time.Millisecond, policy.Backoff(3))
+		assert.Equal(t, 800*time.Millisecond, policy.Backoff(4))
+	})
+	t.Run("is capped at MaxBackoff", func(t *testing.T) {
+		assert.Equal(t, time.Second, policy.Backoff(5))
+		assert.Equal(t, time.Second, policy.Backoff(100))
+	})
+}
+
+func TestRetryPolicyWithDefaults(t *testing.T) {
+	assert.Equal(t, DefaultRetryPolicy(), RetryPolicy{}.withDefaults())
+
+	policy := RetryPolicy{MaxAttempts: 2, AttemptTimeout: time.Second}.withDefaults()
+	assert.Equal(t, 2, policy.MaxAttempts)
+	assert.Equal(t, time.Second, policy.AttemptTimeout)
+	assert.Equal(t, DefaultRetryPolicy().ClientWaitTimeout, policy.ClientWaitTimeout)
+
+	assert.Equal(t, DefaultRetryPolicy(), NewServer(ServerConfig{}).RetryPolicy, "servers never run without a usable policy")
+}
@@ -0,0 +1,114 @@
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"time"
+)
+
+//DefaultStatesDir is used if ServerConfig.StatesDir is empty
+const DefaultStatesDir = "states"
+
+const runMetadataFileName = "run.json"
+
+//RunMetadata is stored as run.json next to the states of a run
+type RunMetadata struct {
+	Name          string         `json:"name"`
+	StartedAt     time.Time      `json:"started_at"`
+	Config        ServerConfig   `json:"config"`
+	BigBangConfig *BigBangConfig `json:"big_bang_config,omitempty"`
+	Build         BuildInfo      `json:"build"`
+}
+
+//BuildInfo of the running binary
+type BuildInfo struct {
+	GoVersion string `json:"go_version"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	Module    string `json:"module"`
+	Version   string `json:"version"`
+}
+
+//RunFolder the states of the run are saved in. Without a runName the states are saved directly in statesDir
+func RunFolder(statesDir, runName string) string {
+	if statesDir == "" {
+		statesDir = DefaultStatesDir
+	}
+	return filepath.Join(statesDir, runName)
+}
+
+//ValidateRunName so that it can be used as a folder name
+func ValidateRunName(runName string) error {
+	if runName == "." || runName == ".." || strings.ContainsAny(runName, `/\`) {
+		return fmt.Errorf("run name %q must not contain path separators", runName)
+	}
+	return nil
+}
+
+//StatesFolder of the configured run
+func (c ServerConfig) StatesFolder() string {
+	return RunFolder(c.StatesDir, c.RunName)
+}
+
+//RunNames of the runs in statesDir that have run metadata
+func RunNames(statesDir string) ([]string, error) {
+	files, err := ioutil.ReadDir(RunFolder(statesDir, ""))
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, f := range files {
+		if _, err := os.Stat(filepath.Join(RunFolder(statesDir, f.Name()), runMetadataFileName)); f.IsDir() && err == nil {
+			names = append(names, f.Name())
+		}
+	}
+	return names, nil
+}
+
+//ReadRunMetadata stored in folder
+func ReadRunMetadata(folder string) (*RunMetadata, error) {
+	data, err := ioutil.ReadFile(filepath.Join(folder, runMetadataFileName))
+	if err != nil {
+		return nil, err
+	}
+	metadata := &RunMetadata{}
+	return metadata, json.Unmarshal(data, metadata)
+}
+
+//writeRunMetadata into the states folder, replacing the metadata of an earlier start of the run
+func (s *Server) writeRunMetadata() error {
+	folder := s.StatesFolder()
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(&RunMetadata{
+		Name:          s.RunName,
+		StartedAt:     time.Now(),
+		Config:        s.ServerConfig,
+		BigBangConfig: s.SimulationState.BigBangConfig,
+		Build:         currentBuildInfo(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(folder, runMetadataFileName), data, 0644)
+}
+
+func currentBuildInfo() BuildInfo {
+	info := BuildInfo{
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		info.Module = buildInfo.Main.Path
+		info.Version = buildInfo.Main.Version
+	}
+	return info
+}
@@ -0,0 +1,52 @@
+package master
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunFolder(t *testing.T) {
+	assert.Equal(t, "states", RunFolder("", ""))
+	assert.Equal(t, filepath.Join("out", "exp1"), RunFolder("out", "exp1"))
+	assert.NoError(t, ValidateRunName("exp1"))
+	assert.Error(t, ValidateRunName("../exp1"))
+	assert.Error(t, ValidateRunName(".."))
+}
+
+func TestNamedRuns(t *testing.T) {
+	defer cleanup()
+
+	first := NewServer(ServerConfig{StatesDir: testStatesFolderName, RunName: "first", BucketWidth: 500})
+	first.SimulationState = testState()
+	second := NewServer(ServerConfig{StatesDir: testStatesFolderName, RunName: "second", BucketWidth: 500})
+	second.SimulationState = NewSimulationState(Buckets{})
+
+	require.NoError(t, first.writeRunMetadata())
+	require.NoError(t, second.writeRunMetadata())
+	require.NoError(t, first.StateStore.Save("STATE_20190301120000", first.SimulationState))
+	require.NoError(t, second.StateStore.Save("STATE_20190301120001", second.SimulationState))
+
+	names, err := RunNames(testStatesFolderName)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, names)
+
+	metadata, err := ReadRunMetadata(first.StatesFolder())
+	require.NoError(t, err)
+	assert.Equal(t, "first", metadata.Name)
+	expectedConfig := first.ServerConfig
+	expectedConfig.StateStore = nil
+	assert.Equal(t, expectedConfig, metadata.Config)
+	assert.Equal(t, first.BigBangConfig, metadata.BigBangConfig)
+	assert.NotEmpty(t, metadata.Build.GoVersion)
+
+	latest, err := LoadLatestState(first.StateStore)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(42), latest.TimeStep, "the state of the first run, not the one of the second run")
+
+	_, err = os.Stat(filepath.Join(testStatesFolderName, runMetadataFileName))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,186 @@
+package master
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+//S3Config of an S3 compatible object storage
+type S3Config struct {
+	//Endpoint like https://s3.eu-central-1.amazonaws.com or http://minio:9000, buckets are addressed path style
+	Endpoint        string
+	Region          string
+	Bucket          string
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+//S3StateStore keeps the states as objects named <Prefix>/<state name> in a bucket
+type S3StateStore struct {
+	S3Config
+
+	client *http.Client
+}
+
+//NewS3StateStore with the given config
+func NewS3StateStore(config S3Config) *S3StateStore {
+	return &S3StateStore{
+		S3Config: config,
+		client:   &http.Client{Timeout: 10 * time.Minute},
+	}
+}
+
+//Save the state as a single object, which only becomes visible once it is completely uploaded
+func (s *S3StateStore) Save(name string, state *SimulationState) error {
+	body := &bytes.Buffer{}
+	if err := WriteState(body, state, time.Now()); err != nil {
+		return err
+	}
+	response, err := s.do(http.MethodPut, s.key(name), nil, body.Bytes())
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+//Load the state with the given name, decoding it while it is downloaded
+func (s *S3StateStore) Load(name string) (*SimulationState, error) {
+	response, err := s.do(http.MethodGet, s.key(name), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	return ReadState(response.Body)
+}
+
+//List the names of all states below the prefix, oldest first
+func (s *S3StateStore) List() ([]string, error) {
+	keyPrefix := s.key("")
+	names := []string{}
+	query := url.Values{"list-type": {"2"}, "prefix": {keyPrefix}}
+	for {
+		response, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		result := &s3ListBucketResult{}
+		err = xml.NewDecoder(response.Body).Decode(result)
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			name := strings.TrimPrefix(object.Key, keyPrefix)
+			if !strings.Contains(name, "/") {
+				names = append(names, name)
+			}
+		}
+		if !result.IsTruncated {
+			break
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+	return sortStateNames(names), nil
+}
+
+//Latest state name below the prefix
+func (s *S3StateStore) Latest() (string, error) {
+	names, err := s.List()
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("there are no states in s3://%v/%v", s.Bucket, s.key(""))
+	}
+	return names[len(names)-1], nil
+}
+
+//Delete the state with the given name and its report, deleting missing objects succeeds in s3
+func (s *S3StateStore) Delete(name string) error {
+	for _, key := range []string{s.key(reportName(name)), s.key(name)} {
+		response, err := s.do(http.MethodDelete, key, nil, nil)
+		if err != nil {
+			return err
+		}
+		response.Body.Close()
+	}
+	return nil
+}
+
+//SaveReport next to the state with the given name
+func (s *S3StateStore) SaveReport(stateName string, report []byte) error {
+	response, err := s.do(http.MethodPut, s.key(reportName(stateName)), nil, report)
+	if err != nil {
+		return err
+	}
+	return response.Body.Close()
+}
+
+func (s *S3StateStore) key(name string) string {
+	if s.Prefix == "" {
+		return name
+	}
+	return strings.Trim(s.Prefix, "/") + "/" + name
+}
+
+//do a signed request on the object with the given key, or on the bucket if key is empty.
+//Responses with an error status are turned into an error
+func (s *S3StateStore) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	endpoint, err := url.Parse(s.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	endpoint.Path = path.Join("/", endpoint.Path, s.Bucket, key)
+	endpoint.RawPath = awsURIEncode(endpoint.Path, false)
+	endpoint.RawQuery = query.Encode()
+
+	request, err := http.NewRequest(method, endpoint.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		payloadHash = sha256Hex(body)
+	}
+	signV4(request, payloadHash, s.AccessKeyID, s.SecretAccessKey, s.Region, time.Now())
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode >= 300 {
+		defer response.Body.Close()
+		return nil, s3Error(method, key, response)
+	}
+	return response, nil
+}
+
+type s3ListBucketResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+//s3Error builds an error from the xml error response of s3
+func s3Error(method, key string, response *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 4096))
+	errorResponse := &struct {
+		Code    string
+		Message string
+	}{}
+	if xml.Unmarshal(body, errorResponse) != nil || errorResponse.Code == "" {
+		return fmt.Errorf("s3 %v %q failed with %v", method, key, response.Status)
+	}
+	return fmt.Errorf("s3 %v %q failed with %v: %v %v", method, key, response.Status, errorResponse.Code, errorResponse.Message)
+}
@@ -0,0 +1,175 @@
+package master
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testS3AccessKeyID     = "AKIDEXAMPLE"
+	testS3SecretAccessKey = "secret"
+)
+
+//fakeS3 is an in-memory stand-in for the parts of the s3 api the S3StateStore uses.
+//It checks the signature of every request and pages listings after pageSize keys
+type fakeS3 struct {
+	pageSize int
+
+	lock    *sync.Mutex
+	objects map[string][]byte
+}
+
+func startFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{pageSize: 2, lock: &sync.Mutex{}, objects: map[string][]byte{}}
+	return f, httptest.NewServer(f)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	if !f.signatureValid(r, body) {
+		f.writeError(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/bucket":
+		f.list(w, r.URL.Query().Get("prefix"), r.URL.Query().Get("continuation-token"))
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+	case r.Method == http.MethodGet:
+		object, ok := f.objects[key]
+		if !ok {
+			f.writeError(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Write(object)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.writeError(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+//signatureValid by signing a copy of the request that only has the signed headers
+func (f *fakeS3) signatureValid(r *http.Request, body []byte) bool {
+	authorization := r.Header.Get("Authorization")
+	signedHeadersStart := strings.Index(authorization, "SignedHeaders=")
+	if signedHeadersStart < 0 || r.Header.Get("X-Amz-Content-Sha256") != sha256Hex(body) {
+		return false
+	}
+	signedHeaders := strings.SplitN(authorization[signedHeadersStart+len("SignedHeaders="):], ",", 2)[0]
+	signTime, err := time.Parse(sigV4TimeFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+
+	signed, _ := http.NewRequest(r.Method, r.URL.String(), nil)
+	signed.Host = r.Host
+	for _, name := range strings.Split(signedHeaders, ";") {
+		if name != "host" && name != "x-amz-date" && name != "x-amz-content-sha256" {
+			signed.Header.Set(name, r.Header.Get(name))
+		}
+	}
+	signV4(signed, sha256Hex(body), testS3AccessKeyID, testS3SecretAccessKey, "us-east-1", signTime)
+	return signed.Header.Get("Authorization") == authorization
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, prefix, continuationToken string) {
+	keys := []string{}
+	for key := range f.objects {
+		if strings.HasPrefix(key, prefix) && key > continuationToken {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	result := &s3ListBucketResult{}
+	if len(keys) > f.pageSize {
+		keys = keys[:f.pageSize]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, key := range keys {
+		result.Contents = append(result.Contents, struct{ Key string }{key})
+	}
+	xml.NewEncoder(w).Encode(result)
+}
+
+func (f *fakeS3) writeError(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	xml.NewEncoder(w).Encode(&struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: "fake s3 error"})
+}
+
+func testS3StateStore(endpoint, secretAccessKey string) *S3StateStore {
+	return NewS3StateStore(S3Config{
+		Endpoint:        endpoint,
+		Region:          "us-east-1",
+		Bucket:          "bucket",
+		Prefix:          "runs/first",
+		AccessKeyID:     testS3AccessKeyID,
+		SecretAccessKey: secretAccessKey,
+	})
+}
+
+func TestS3StateStore(t *testing.T) {
+	fake, server := startFakeS3(t)
+	defer server.Close()
+	store := testS3StateStore(server.URL, testS3SecretAccessKey)
+
+	t.Run("save, list, load and delete", func(t *testing.T) {
+		names := []string{"STATE_20190301120003", "STATE_20190301120000", "STATE_20190301120002", "STATE_20190301120001"}
+		for _, name := range names {
+			require.NoError(t, store.Save(name, testState()))
+		}
+		fake.lock.Lock()
+		fake.objects["runs/first/SAVING_20190301120004"] = []byte{}
+		fake.objects["runs/firstother/STATE_20190301120009"] = []byte{}
+		fake.objects["runs/first/nested/STATE_20190301120009"] = []byte{}
+		fake.lock.Unlock()
+
+		listed, err := store.List()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"STATE_20190301120000", "STATE_20190301120001", "STATE_20190301120002", "STATE_20190301120003"}, listed)
+
+		loaded, err := LoadLatestState(store)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(42), loaded.TimeStep)
+		assertSameBuckets(t, testState().CellBuckets, loaded.CellBuckets)
+
+		require.NoError(t, pruneStates(store, 1))
+		listed, err = store.List()
+		require.NoError(t, err)
+		assert.Equal(t, []string{"STATE_20190301120003"}, listed)
+	})
+
+	t.Run("missing states", func(t *testing.T) {
+		_, err := store.Load("STATE_20000101000000")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "NoSuchKey")
+	})
+
+	t.Run("wrong credentials are rejected", func(t *testing.T) {
+		_, err := testS3StateStore(server.URL, "wrong").List()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "SignatureDoesNotMatch")
+	})
+}
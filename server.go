@@ -4,12 +4,10 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"sync"
 	"syscall"
 	"time"
@@ -17,16 +15,24 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
+	"github.com/codeuniversity/al-master/filters"
+	"github.com/codeuniversity/al-master/localcis"
+	"github.com/codeuniversity/al-master/logging"
+	"github.com/codeuniversity/al-master/masterproto"
 	"github.com/codeuniversity/al-master/metrics"
+	"github.com/codeuniversity/al-master/tracing"
 	"github.com/codeuniversity/al-master/websocket"
 	"github.com/codeuniversity/al-proto"
 	websocketConn "github.com/gorilla/websocket"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-const (
-	statesFolderName = "states"
-)
+const localCISAddress = "in-process"
+
+//serverLogger logs the course of the simulation and the connections of the server
+var serverLogger = logging.For("server")
 
 //ServerConfig contains config data for Server
 type ServerConfig struct {
@@ -37,6 +43,48 @@ type ServerConfig struct {
 	LoadLatestState   bool
 	BigBangConfigPath string
 	BucketWidth       int
+
+	//StatesDir holds the states of all runs, DefaultStatesDir if empty
+	StatesDir string
+	//RunName groups the states of one experiment in a folder of StatesDir
+	RunName string
+	//StateStore the states are saved to and loaded from, a FileStateStore in the StatesFolder if nil
+	StateStore StateStore `json:"-"`
+
+	HealthCheckInterval time.Duration
+	RetryPolicy         RetryPolicy
+
+	StopConditions StopConditions
+
+	//PopulationStatsPath the PopulationStats of every time step are appended to, as CSV if it ends with .csv
+	//and as JSON lines otherwise. Empty disables the file, the prometheus gauges are always updated
+	PopulationStatsPath string
+
+	//ShutdownGracePeriod a step that is running when a signal is received gets to finish,
+	//before its inflight cis calls are cancelled and it is rolled back
+	ShutdownGracePeriod time.Duration
+
+	//TraceExporter receives spans of every step, its cis calls and the merge of their results. Nil disables tracing
+	TraceExporter tracing.Exporter `json:"-"`
+
+	//TargetTickRate in time steps per second, 0 lets the simulation run as fast as cis answers.
+	//It can be changed at runtime through the control api
+	TargetTickRate float64
+
+	//LocalCISThreads is the amount of in-process cis clients, which lets the master run without any cis instance
+	LocalCISThreads int
+	LocalCISSeed    int64
+
+	//JournalPath to record every batch to, so the run can be replayed with ReplayJournalPath
+	JournalPath       string
+	ReplayJournalPath string
+
+	//CheckpointEverySteps and CheckpointInterval define when the state is saved while running, 0 disables either
+	CheckpointEverySteps uint64
+	CheckpointInterval   time.Duration
+	//CheckpointRetention is the amount of saved states that are kept, 0 keeps all of them.
+	//Without a RunName only the checkpoints saved by this server count, the states of other runs in StatesDir are kept
+	CheckpointRetention int
 }
 
 //Server that manages cell changes
@@ -50,40 +98,151 @@ type Server struct {
 
 	grpcServer *grpc.Server
 	httpServer *http.Server
+	httpMux    *http.ServeMux
+
+	grpcAddr  net.Addr
+	httpAddr  net.Addr
+	listening chan struct{}
+
+	healthWatchDone chan struct{}
+
+	journal *Journal
+	//replayUntilTimeStep is the time step after the last journaled one, 0 if not replaying
+	replayUntilTimeStep uint64
+
+	lastCheckpointTime     time.Time
+	lastCheckpointTimeStep uint64
+	//checkpointNames saved by this server, oldest first
+	checkpointNames []string
+
+	noCellMatchesFilter filters.Set
+	summary             *RunSummary
+
+	populationTracker     *populationTracker
+	populationStatsWriter *PopulationStatsWriter
+	tracer                *tracing.Tracer
+
+	//ctx is cancelled on shutdown to abort all inflight cis calls
+	ctx    context.Context
+	cancel context.CancelFunc
+	//signals end Run with a final checkpoint, a second signal during the shutdown exits right away
+	signals chan os.Signal
+	//runDone is closed once Run returned
+	runDone chan struct{}
+	//exit the process without saving anything, replaced in tests
+	exit func(code int)
+
+	control         *runControl
+	controlCommands chan *controlCommand
 }
 
+var registerMetricsOnce = &sync.Once{}
+
 //NewServer with given config
 func NewServer(config ServerConfig) *Server {
 	clientPool := NewCISClientPool(config.ConnBufferSize)
+	config.RetryPolicy = config.RetryPolicy.withDefaults()
+	if config.StateStore == nil {
+		config.StateStore = NewFileStateStore(config.StatesFolder())
+	}
+	var noCellMatchesFilter filters.Set
+	if len(config.StopConditions.NoCellMatches) > 0 {
+		noCellMatchesFilter = filters.SetFromDefinitions(config.StopConditions.NoCellMatches)
+	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	return &Server{
+		ctx:                         ctx,
+		cancel:                      cancel,
+		runDone:                     make(chan struct{}),
+		exit:                        os.Exit,
+		noCellMatchesFilter:         noCellMatchesFilter,
+		populationTracker:           &populationTracker{},
+		tracer:                      tracing.NewTracer(config.TraceExporter),
 		ServerConfig:                config,
 		websocketConnectionsHandler: websocket.NewConnectionsHandler(),
 		cisClientPool:               clientPool,
+		httpMux:                     http.NewServeMux(),
+		listening:                   make(chan struct{}),
+		healthWatchDone:             make(chan struct{}),
+		signals:                     make(chan os.Signal, 1),
+		control:                     newRunControl(config.TargetTickRate),
+		controlCommands:             make(chan *controlCommand),
 	}
 }
 
 //Init loads state from a file or by asking a cis instance for a new BigBang depending on ServerConfig
 func (s *Server) Init() {
 	s.initPrometheus()
-	go s.listen()
+	s.listen()
+	go s.cisClientPool.WatchHealth(s.HealthCheckInterval, s.healthWatchDone)
+	s.addLocalCISClients()
 
+	if s.ReplayJournalPath != "" {
+		s.initReplay()
+		return
+	}
+	s.initState()
+	s.Rebucket(s.ServerConfig.BucketWidth)
+	s.initRunMetadata()
+	s.initJournal()
+	s.initPopulationStats()
+}
+
+func (s *Server) initPopulationStats() {
+	if s.PopulationStatsPath == "" {
+		return
+	}
+	writer, err := OpenPopulationStatsWriter(s.PopulationStatsPath)
+	if err != nil {
+		serverLogger.WithError(err).With("path", s.PopulationStatsPath).Error("opening the population stats file failed, exiting now")
+		panic(err)
+	}
+	s.populationStatsWriter = writer
+}
+
+//recordPopulation of the current time step
+func (s *Server) recordPopulation() {
+	stats := s.populationTracker.track(s.TimeStep, s.CellBuckets)
+	updatePopulationMetrics(stats)
+	if s.populationStatsWriter == nil {
+		return
+	}
+	if err := s.populationStatsWriter.Write(stats); err != nil {
+		serverLogger.WithError(err).With("time_step", s.TimeStep).Warn("couldn't write population stats")
+	}
+}
+
+//initRunMetadata of named runs. Unnamed runs share the states dir, so metadata would be ambiguous there
+func (s *Server) initRunMetadata() {
+	if s.RunName == "" {
+		return
+	}
+	if err := s.writeRunMetadata(); err != nil {
+		serverLogger.WithError(err).With("run_name", s.RunName).Error("writing run metadata failed, exiting now")
+		panic(err)
+	}
+}
+
+func (s *Server) initState() {
 	if s.StateFileName != "" {
-		simulationState, err := LoadSimulationState(filepath.Join(statesFolderName, s.StateFileName))
+		simulationState, err := s.StateStore.Load(s.StateFileName)
 		if err != nil {
-			fmt.Println("\nLoading state from filepath failed, exiting now", err)
+			stateLogger.WithError(err).With("state", s.StateFileName).Error("loading state failed, exiting now")
 			panic(err)
 		}
+		stateLoaded(s.StateFileName, simulationState)
 		s.SimulationState = simulationState
 		return
 	}
 
 	if s.LoadLatestState {
-		simulationState, err := LoadLatestSimulationState()
+		simulationState, err := LoadLatestState(s.StateStore)
 		if err != nil {
-			fmt.Println("\nLoading latest state failed, exiting now", err)
+			stateLogger.WithError(err).Error("loading latest state failed, exiting now")
 			panic(err)
 		}
+		stateLoaded("latest", simulationState)
 		s.SimulationState = simulationState
 		return
 	}
@@ -93,21 +252,56 @@ func (s *Server) Init() {
 
 //Run offloads the computation of changes to cis
 func (s *Server) Run() {
-	signals := make(chan os.Signal, 1)
-	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(s.signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(s.signals)
+	defer close(s.runDone)
+	s.lastCheckpointTime = time.Now()
+	s.lastCheckpointTimeStep = s.TimeStep
+	s.startSummary(s.lastCheckpointTime)
+	s.recordPopulation()
 
 	for {
 		if len(s.CellBuckets.AllCells()) == 0 {
-			fmt.Println("no cells remaining, stopping...")
+			serverLogger.With("time_step", s.TimeStep).Info("no cells remaining, stopping")
 			s.closeConnections()
 			return
 		}
 
-		if len(signals) != 0 {
-			fmt.Println("Received Signal:", <-signals)
+		if s.replayUntilTimeStep != 0 && s.TimeStep >= s.replayUntilTimeStep {
+			serverLogger.With("time_step", s.TimeStep).Info("replay reached the end of the journal, stopping")
+			s.closeConnections()
+			return
+		}
+
+		if reason := s.stopReason(time.Now()); reason != "" {
+			s.finish(reason)
+			return
+		}
+
+		if received := s.awaitStep(s.signals); received != nil {
+			s.beginShutdown(received)
+			break
+		}
+		received, err := s.runStep()
+		if err != nil {
+			backoff := s.control.recordStepFailed(time.Now(), s.RetryPolicy)
+			logger := serverLogger.WithError(err).With("time_step", s.TimeStep).With("retry_in", backoff)
+			if batchErr, ok := err.(*BatchFailedError); ok {
+				logger = logger.With("bucket_key", batchErr.BatchKey)
+			}
+			logger.Warn("step aborted, rolled back to the previous time step")
+			s.summary.FailedSteps++
+		}
+		if received != nil {
 			break
 		}
-		s.step()
+		if err != nil {
+			continue
+		}
+		s.stepFinished()
+		if s.replayUntilTimeStep == 0 {
+			s.checkpointIfDue()
+		}
 	}
 	s.shutdown()
 }
@@ -115,42 +309,150 @@ func (s *Server) Run() {
 //Register cis-slave and create clients to make the slave useful
 func (s *Server) Register(ctx context.Context, registration *proto.SlaveRegistration) (*proto.SlaveRegistrationResponse, error) {
 	for i := 0; i < int(registration.Threads); i++ {
-		client, err := createCellInteractionClient(registration.Address)
+		client, err := NewCISClient(registration.Address)
 		if err != nil {
 			return nil, err
 		}
 		s.cisClientPool.AddClient(client)
-		metrics.CISClientCount.Inc()
 	}
+	serverLogger.With("slave_address", registration.Address).With("threads", registration.Threads).Info("slave registered")
 	return &proto.SlaveRegistrationResponse{}, nil
 }
 
+//Deregister cis-slave by removing all of its clients. Returns once the calls that are inflight on the slave have finished
+func (s *Server) Deregister(ctx context.Context, deregistration *masterproto.SlaveDeregistration) (*masterproto.SlaveDeregistrationResponse, error) {
+	drained, ok := s.cisClientPool.RemoveSlave(deregistration.Address)
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "no slave registered with address %v", deregistration.Address)
+	}
+
+	serverLogger.With("slave_address", deregistration.Address).Info("slave deregistering")
+
+	select {
+	case <-drained:
+		return &masterproto.SlaveDeregistrationResponse{}, nil
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	case <-s.ctx.Done():
+		return nil, status.Error(codes.Unavailable, "the master is shutting down")
+	}
+}
+
+func (s *Server) initReplay() {
+	replayClient, err := NewReplayClient(s.ReplayJournalPath)
+	if err != nil {
+		serverLogger.WithError(err).With("path", s.ReplayJournalPath).Error("loading journal failed, exiting now")
+		panic(err)
+	}
+	s.cisClientPool.AddClient(&CISClient{CellInteractionServiceClient: replayClient, Address: replayCISAddress})
+	s.BucketWidth = replayClient.BucketWidth
+	s.SimulationState = replayClient.InitialState()
+	s.replayUntilTimeStep = replayClient.LastTimeStep + 1
+}
+
+func (s *Server) initJournal() {
+	if s.JournalPath == "" {
+		return
+	}
+	journal, err := CreateJournal(s.JournalPath, s.BucketWidth)
+	if err != nil {
+		serverLogger.WithError(err).With("path", s.JournalPath).Error("creating journal failed, exiting now")
+		panic(err)
+	}
+	s.journal = journal
+}
+
+//recordInJournal if journaling is enabled
+func (s *Server) recordInJournal(kind JournalEntryKind, batch *proto.CellComputeBatch) {
+	if s.journal == nil {
+		return
+	}
+	if err := s.journal.Record(kind, batch); err != nil {
+		serverLogger.WithError(err).With("time_step", batch.TimeStep).With("bucket_key", batch.BatchKey).Warn("couldn't record batch in journal")
+	}
+}
+
+func (s *Server) flushJournal() {
+	if s.journal == nil {
+		return
+	}
+	if err := s.journal.Flush(); err != nil {
+		serverLogger.WithError(err).With("time_step", s.TimeStep).Warn("couldn't flush journal")
+	}
+}
+
+func (s *Server) addLocalCISClients() {
+	for i := 0; i < s.LocalCISThreads; i++ {
+		s.cisClientPool.AddClient(&CISClient{
+			CellInteractionServiceClient: localcis.NewClient(s.LocalCISSeed),
+			Address:                      localCISAddress,
+		})
+	}
+}
+
+//GRPCAddr the registration service listens on. Blocks until the server is listening
+func (s *Server) GRPCAddr() net.Addr {
+	<-s.listening
+	return s.grpcAddr
+}
+
+//HTTPAddr the websocket and metrics endpoints listen on. Blocks until the server is listening
+func (s *Server) HTTPAddr() net.Addr {
+	<-s.listening
+	return s.httpAddr
+}
+
 func (s *Server) initPrometheus() {
-	prometheus.MustRegister(metrics.AmountOfBuckets)
-	prometheus.MustRegister(metrics.AverageCellsPerBucket)
-	prometheus.MustRegister(metrics.MedianCellsPerBucket)
-	prometheus.MustRegister(metrics.MinCellsInBuckets)
-	prometheus.MustRegister(metrics.MaxCellsInBuckets)
-	prometheus.MustRegister(metrics.CISCallCounter)
-	prometheus.MustRegister(metrics.CisCallDurationSeconds)
-	prometheus.MustRegister(metrics.CISClientCount)
-	prometheus.MustRegister(metrics.WebSocketConnectionsCount)
+	// the metrics are global, so they may only be registered once per process
+	registerMetricsOnce.Do(func() {
+		prometheus.MustRegister(metrics.AmountOfBuckets)
+		prometheus.MustRegister(metrics.AverageCellsPerBucket)
+		prometheus.MustRegister(metrics.MedianCellsPerBucket)
+		prometheus.MustRegister(metrics.MinCellsInBuckets)
+		prometheus.MustRegister(metrics.MaxCellsInBuckets)
+		prometheus.MustRegister(metrics.CISCallCounter)
+		prometheus.MustRegister(metrics.CisCallDurationSeconds)
+		prometheus.MustRegister(metrics.CISClientCount)
+		prometheus.MustRegister(metrics.CISSlaveEvictionCounter)
+		prometheus.MustRegister(metrics.StepRollbackCounter)
+		prometheus.MustRegister(metrics.CISCallRetryCounter)
+		prometheus.MustRegister(metrics.CISClientWaitSeconds)
+		prometheus.MustRegister(metrics.StepDurationSeconds)
+		prometheus.MustRegister(metrics.StepBatchCount)
+		prometheus.MustRegister(metrics.StepPredispatchedBatchCount)
+		prometheus.MustRegister(metrics.BatchCellsToCompute)
+		prometheus.MustRegister(metrics.BatchCellsInProximity)
+		prometheus.MustRegister(metrics.TargetTickRate)
+		prometheus.MustRegister(metrics.ActualTickRate)
+		prometheus.MustRegister(metrics.PopulationCellCount)
+		prometheus.MustRegister(metrics.PopulationTotalEnergy)
+		prometheus.MustRegister(metrics.PopulationMeanEnergy)
+		prometheus.MustRegister(metrics.PopulationMeanDnaLength)
+		prometheus.MustRegister(metrics.PopulationBirths)
+		prometheus.MustRegister(metrics.PopulationDeaths)
+		prometheus.MustRegister(metrics.PopulationBoundingBoxMin)
+		prometheus.MustRegister(metrics.PopulationBoundingBoxMax)
+		prometheus.MustRegister(metrics.WebSocketConnectionsCount)
+	})
 
-	http.Handle("/metrics", promhttp.Handler())
+	s.httpMux.Handle("/metrics", promhttp.Handler())
 }
 
 func (s *Server) shutdown() {
 	s.closeConnections()
 
-	err := s.saveState()
-	if err == nil {
-		fmt.Println("\nState successfully saved")
-	} else {
-		fmt.Println("\nState could not be saved:", err)
+	stateName, err := s.checkpoint()
+	if err != nil {
+		stateLogger.WithError(err).With("time_step", s.TimeStep).Error("state could not be saved")
+		return
 	}
+	stateLogger.With("state", stateName).With("time_step", s.TimeStep).Info("state successfully saved")
 }
 
 func (s *Server) closeConnections() {
+	s.cancel()
+	s.discardInflightBatches()
+	close(s.healthWatchDone)
 	s.websocketConnectionsHandler.Shutdown()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
@@ -158,9 +460,23 @@ func (s *Server) closeConnections() {
 
 	err := s.httpServer.Shutdown(ctx)
 	if err != nil {
-		fmt.Println("Couldn't shutdown http server", err)
+		serverLogger.WithError(err).Warn("couldn't shutdown http server")
+	}
+	s.stopGRPCServer()
+
+	if s.journal != nil {
+		if err := s.journal.Close(); err != nil {
+			serverLogger.WithError(err).Warn("couldn't close journal")
+		}
+	}
+	if s.populationStatsWriter != nil {
+		if err := s.populationStatsWriter.Close(); err != nil {
+			serverLogger.WithError(err).Warn("couldn't close population stats")
+		}
+	}
+	if err := s.tracer.Close(); err != nil {
+		serverLogger.WithError(err).Warn("couldn't close trace exporter")
 	}
-	s.grpcServer.Stop()
 }
 
 func (s *Server) fetchBigBang() {
@@ -168,9 +484,12 @@ func (s *Server) fetchBigBang() {
 	if err != nil {
 		panic(err)
 	}
-	c := s.cisClientPool.GetClient()
-	defer s.cisClientPool.AddClient(c)
-	withTimeout(100*time.Second, func(ctx context.Context) {
+	c, err := s.cisClientPool.GetClient(s.ctx)
+	if err != nil {
+		panic(err)
+	}
+	defer s.cisClientPool.ReturnClient(c)
+	withTimeout(s.ctx, 100*time.Second, func(ctx context.Context) {
 		stream, err := c.BigBang(ctx, config.ToProto())
 		if err != nil {
 			panic(err)
@@ -180,7 +499,7 @@ func (s *Server) fetchBigBang() {
 			cell, err := stream.Recv()
 			if err != nil {
 				if err != io.EOF {
-					log.Fatal(err)
+					serverLogger.WithError(err).Fatal("receiving the big bang failed")
 				}
 				break
 			}
@@ -188,28 +507,47 @@ func (s *Server) fetchBigBang() {
 		}
 		buckets := CreateBuckets(cells, uint(s.BucketWidth))
 		s.SimulationState = NewSimulationState(buckets)
+		s.SimulationState.CellBucketWidth = s.ServerConfig.BucketWidth
+		s.SimulationState.BigBangConfig = config
 	})
 }
 
+//listen binds the grpc and http ports and serves both in the background
 func (s *Server) listen() {
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%v", s.GRPCPort))
+	grpcListener, err := net.Listen("tcp", fmt.Sprintf(":%v", s.GRPCPort))
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		serverLogger.WithError(err).With("port", s.GRPCPort).Fatal("failed to listen")
 	}
+	httpListener, err := net.Listen("tcp", fmt.Sprintf(":%v", s.HTTPPort))
+	if err != nil {
+		serverLogger.WithError(err).With("port", s.HTTPPort).Fatal("failed to listen")
+	}
+	s.grpcAddr = grpcListener.Addr()
+	s.httpAddr = httpListener.Addr()
+
 	s.grpcServer = grpc.NewServer()
 	proto.RegisterSlaveRegistrationServiceServer(s.grpcServer, s)
+	masterproto.RegisterSlaveDeregistrationServiceServer(s.grpcServer, s)
 
 	go func() {
-		if err := s.grpcServer.Serve(lis); err != nil {
-			log.Fatalf("failed to serve: %v", err)
+		if err := s.grpcServer.Serve(grpcListener); err != nil {
+			serverLogger.WithError(err).Fatal("failed to serve grpc")
 		}
 	}()
 
-	http.HandleFunc("/", s.websocketHandler)
-	s.httpServer = &http.Server{Addr: fmt.Sprintf(":%v", s.HTTPPort), Handler: nil}
-	if err := s.httpServer.ListenAndServe(); err != nil {
-		log.Println(err)
-	}
+	s.initControlAPI()
+	s.httpMux.HandleFunc("/filters/validate", websocket.ValidateFilterHandler)
+	s.httpMux.HandleFunc("/", s.websocketHandler)
+	// pprof registers itself on the default mux
+	s.httpMux.Handle("/debug/pprof/", http.DefaultServeMux)
+	s.httpServer = &http.Server{Handler: s.httpMux}
+	go func() {
+		if err := s.httpServer.Serve(httpListener); err != nil && err != http.ErrServerClosed {
+			serverLogger.WithError(err).Error("failed to serve http")
+		}
+	}()
+
+	close(s.listening)
 }
 
 var upgrader = websocketConn.Upgrader{
@@ -223,7 +561,7 @@ var upgrader = websocketConn.Upgrader{
 func (s *Server) websocketHandler(w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println(err)
+		serverLogger.WithError(err).With("remote_address", r.RemoteAddr).Warn("websocket upgrade failed")
 		return
 	}
 
@@ -231,14 +569,25 @@ func (s *Server) websocketHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) broadcastCurrentState() {
-	s.websocketConnectionsHandler.BroadcastCells(s.CellBuckets.AllCells())
+	s.websocketConnectionsHandler.BroadcastIndex(&bucketIndex{buckets: s.CellBuckets, width: s.BucketWidth})
 }
 
-func (s *Server) step() {
+//step computes the next time step. If one of the batches fails, the step is aborted
+//and the state is left at the previous time step, so the step can simply be tried again
+func (s *Server) step() (err error) {
+	start := time.Now()
+	ctx, span := s.tracer.Start(s.ctx, "step")
+	span.SetAttribute("time_step", s.TimeStep)
+	span.SetAttribute("bucket_count", len(s.CellBuckets))
+	defer func() {
+		metrics.StepDurationSeconds.Observe(time.Since(start).Seconds())
+		span.SetError(err)
+		span.Finish()
+	}()
 	UpdateBucketsMetrics(s.CellBuckets)
-	doneChan := make(chan struct{})
+	doneChan := make(chan error)
 
-	go s.processReturnedBatches(s.CurrentReturnedBatchChan(), doneChan)
+	go s.processReturnedBatches(ctx, s.CurrentReturnedBatchChan(), doneChan)
 	for key, bucket := range s.CellBuckets {
 		if s.RequestInflightFromLastStep(key) {
 			continue
@@ -257,43 +606,154 @@ func (s *Server) step() {
 			TimeStep:         s.TimeStep,
 			BatchKey:         string(key),
 		}
-		go s.callCIS(batch, s.CurrentWaitGroup(), s.CurrentReturnedBatchChan())
+		go s.callCIS(ctx, batch, s.CurrentWaitGroup(), s.CurrentReturnedBatchChan())
 	}
 
 	s.CurrentWaitGroup().Wait()
+	s.CloseCurrentReturnedBatchChan()
+	if err := <-doneChan; err != nil {
+		metrics.StepRollbackCounter.Inc()
+		s.DiscardNextStep()
+		s.recordInJournal(JournalEntryRollback, &proto.CellComputeBatch{TimeStep: s.TimeStep})
+		s.flushJournal()
+		return err
+	}
+	s.recordInJournal(JournalEntryCommit, &proto.CellComputeBatch{TimeStep: s.TimeStep})
 	s.Cycle()
-	<-doneChan
 	s.TimeStep++
-	fmt.Println(s.TimeStep, ": ", len(s.CellBuckets.AllCells()))
+	s.flushJournal()
+	serverLogger.With("time_step", s.TimeStep).With("cell_count", len(s.CellBuckets.AllCells())).Info("step finished")
+	s.recordPopulation()
 	s.broadcastCurrentState()
+	return nil
 }
 
-func (s *Server) callCIS(batch *proto.CellComputeBatch, wg *sync.WaitGroup, returnedBatchChan chan *proto.CellComputeBatch) {
+func (s *Server) callCIS(ctx context.Context, batch *proto.CellComputeBatch, wg *sync.WaitGroup, returnedBatchChan chan *BatchResult) {
+	defer wg.Done()
+	ctx, span := s.tracer.Start(ctx, "callCIS")
+	span.SetAttribute("bucket_key", batch.BatchKey)
+	span.SetAttribute("time_step", batch.TimeStep)
+	span.SetAttribute("cells_to_compute", len(batch.CellsToCompute))
+	span.SetAttribute("cells_in_proximity", len(batch.CellsInProximity))
+	defer span.Finish()
 	metrics.CISCallCounter.Inc()
-	looping := true
-	for looping {
-		c := s.cisClientPool.GetClient()
-		withTimeout(10*time.Second, func(ctx context.Context) {
-			start := time.Now()
-			returnedBatch, err := c.ComputeCellInteractions(ctx, batch)
-			metrics.CisCallDurationSeconds.Observe(time.Since(start).Seconds())
-			if err == nil {
-				s.cisClientPool.AddClient(c)
-				returnedBatchChan <- returnedBatch
-				looping = false
-			} else {
-				metrics.CISClientCount.Dec()
-			}
-		})
+	metrics.BatchCellsToCompute.Observe(float64(len(batch.CellsToCompute)))
+	metrics.BatchCellsInProximity.Observe(float64(len(batch.CellsInProximity)))
+	s.recordInJournal(JournalEntrySent, batch)
+
+	var err error
+	attempts := 0
+	// once ctx is cancelled by a shutdown, no further attempts are made
+	for attempts < s.RetryPolicy.MaxAttempts && ctx.Err() == nil {
+		attempts++
+		if attempts > 1 {
+			metrics.CISCallRetryCounter.Inc()
+			serverLogger.WithError(err).With("time_step", batch.TimeStep).With("bucket_key", batch.BatchKey).With("attempt", attempts).Debug("retrying batch")
+			sleepContext(ctx, s.RetryPolicy.Backoff(attempts-1))
+		}
+		var returnedBatch *proto.CellComputeBatch
+		returnedBatch, err = s.computeBatch(ctx, batch, attempts)
+		if err == nil {
+			span.SetAttribute("attempts", attempts)
+			s.recordInJournal(JournalEntryReturned, returnedBatch)
+			returnedBatchChan <- &BatchResult{Batch: returnedBatch}
+			return
+		}
+	}
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+
+	span.SetAttribute("attempts", attempts)
+	span.SetError(err)
+	returnedBatchChan <- &BatchResult{
+		Batch: batch,
+		Err: &BatchFailedError{
+			BatchKey: BucketKey(batch.BatchKey),
+			TimeStep: batch.TimeStep,
+			Attempts: attempts,
+			Err:      err,
+		},
+	}
+}
+
+//computeBatch makes a single attempt at letting a cis compute the batch
+func (s *Server) computeBatch(ctx context.Context, batch *proto.CellComputeBatch, attempt int) (returnedBatch *proto.CellComputeBatch, err error) {
+	ctx, span := s.tracer.Start(ctx, "computeBatch")
+	span.SetAttribute("attempt", attempt)
+	defer func() {
+		span.SetError(err)
+		span.Finish()
+	}()
+
+	var c *CISClient
+	withTimeout(ctx, s.RetryPolicy.ClientWaitTimeout, func(ctx context.Context) {
+		start := time.Now()
+		c, err = s.cisClientPool.GetClient(ctx)
+		metrics.CISClientWaitSeconds.Observe(time.Since(start).Seconds())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttribute("slave_address", c.Address)
+
+	withTimeout(ctx, s.RetryPolicy.AttemptTimeout, func(ctx context.Context) {
+		start := time.Now()
+		returnedBatch, err = c.ComputeCellInteractions(tracing.Inject(ctx), batch)
+		metrics.CisCallDurationSeconds.Observe(time.Since(start).Seconds())
+	})
+	if err != nil {
+		if isSlaveFailure(ctx, err) {
+			s.cisClientPool.ReportFailure(c)
+		} else {
+			s.cisClientPool.ReturnClient(c)
+		}
+		return nil, err
 	}
-	wg.Done()
+	s.cisClientPool.ReportSuccess(c)
+	return returnedBatch, nil
 }
 
-func (s *Server) processReturnedBatches(returnedBatchChan chan *proto.CellComputeBatch, doneChan chan struct{}) {
+//isSlaveFailure unless the call was cancelled because ctx, the context of the attempt without its timeout, is done,
+//e.g. on shutdown, which says nothing about the health of the slave. Running out of the attempt timeout means the slave hangs
+func isSlaveFailure(ctx context.Context, err error) bool {
+	if ctx.Err() == nil {
+		return true
+	}
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Canceled, codes.DeadlineExceeded:
+		return false
+	}
+	return true
+}
+
+//processReturnedBatches merges the returned batches into the next buckets and sends the first failure of the step
+//or nil into doneChan when returnedBatchChan is closed. s.CellBuckets is only replaced if no batch failed
+func (s *Server) processReturnedBatches(ctx context.Context, returnedBatchChan chan *BatchResult, doneChan chan error) {
+	ctx, span := s.tracer.Start(ctx, "merge")
 	nextBuckets := Buckets{}
 	doneNeighbourBuckets := map[BucketKey]int{}
-
-	for returnedBatch := range returnedBatchChan {
+	var stepErr error
+	batchCount, predispatchedCount := 0, 0
+	// busy is the time spent merging and dispatching, as opposed to waiting for returned batches
+	var busy time.Duration
+
+	for result := range returnedBatchChan {
+		batchCount++
+		busyStart := time.Now()
+		if result.Err != nil && stepErr == nil {
+			stepErr = result.Err
+		}
+		if stepErr != nil {
+			// the step is going to be discarded, so there is no point in requesting any more batches
+			busy += time.Since(busyStart)
+			continue
+		}
+		returnedBatch := result.Batch
 		returnedBuckets := CreateBuckets(returnedBatch.CellsToCompute, uint(s.BucketWidth))
 		nextBuckets.Merge(returnedBuckets)
 		bucketKey := BucketKey(returnedBatch.BatchKey)
@@ -324,25 +784,38 @@ func (s *Server) processReturnedBatches(returnedBatchChan chan *proto.CellComput
 				BatchKey:         string(key),
 			}
 			s.NextWaitGroup().Add(1)
-			go s.callCIS(batch, s.NextWaitGroup(), s.NextReturnedBatchChan())
+			go s.callCIS(ctx, batch, s.NextWaitGroup(), s.NextReturnedBatchChan())
 
 			s.MarkRequestInflight(key)
+			predispatchedCount++
 		}
+		busy += time.Since(busyStart)
 	}
-	s.CellBuckets = nextBuckets
-	doneChan <- struct{}{}
+	metrics.StepBatchCount.Observe(float64(batchCount))
+	metrics.StepPredispatchedBatchCount.Observe(float64(predispatchedCount))
+	if stepErr == nil {
+		s.CellBuckets = nextBuckets
+	}
+	span.SetAttribute("batches", batchCount)
+	span.SetAttribute("predispatched_batches", predispatchedCount)
+	span.SetAttribute("busy_seconds", busy.Seconds())
+	span.SetError(stepErr)
+	span.Finish()
+	doneChan <- stepErr
 }
 
-func withTimeout(timeout time.Duration, f func(ctx context.Context)) {
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-	f(ctx)
+//sleepContext for duration or until ctx is done
+func sleepContext(ctx context.Context, duration time.Duration) {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
 }
 
-func createCellInteractionClient(address string) (proto.CellInteractionServiceClient, error) {
-	conn, err := grpc.Dial(address, grpc.WithInsecure())
-	if err != nil {
-		return nil, err
-	}
-	return proto.NewCellInteractionServiceClient(conn), nil
+func withTimeout(parent context.Context, timeout time.Duration, f func(ctx context.Context)) {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	f(ctx)
 }
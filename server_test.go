@@ -0,0 +1,430 @@
+package master
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/codeuniversity/al-master/tracing"
+	"github.com/codeuniversity/al-proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const stepDeadlockTimeout = 10 * time.Second
+
+//fakeSlave is a cis instance that moves every cell by one unit along the x axis per time step
+type fakeSlave struct {
+	delay time.Duration
+	//failing is set to 1 to let every ComputeCellInteractions call fail
+	failing int32
+	//lastTimeStep after which all cells die
+	lastTimeStep uint64
+
+	address    string
+	grpcServer *grpc.Server
+
+	lock              *sync.Mutex
+	timeStepsPerBatch map[string][]uint64
+	//traceparentsPerTimeStep received with the ComputeCellInteractions calls
+	traceparentsPerTimeStep map[uint64][]string
+}
+
+func startFakeSlave(t *testing.T, delay time.Duration) *fakeSlave {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	slave := &fakeSlave{
+		delay:             delay,
+		address:           listener.Addr().String(),
+		grpcServer:        grpc.NewServer(),
+		lock:              &sync.Mutex{},
+		timeStepsPerBatch: map[string][]uint64{},
+
+		traceparentsPerTimeStep: map[uint64][]string{},
+	}
+	proto.RegisterCellInteractionServiceServer(slave.grpcServer, slave)
+	go slave.grpcServer.Serve(listener)
+	return slave
+}
+
+func (f *fakeSlave) setFailing(failing bool) {
+	if failing {
+		atomic.StoreInt32(&f.failing, 1)
+	} else {
+		atomic.StoreInt32(&f.failing, 0)
+	}
+}
+
+func (f *fakeSlave) ComputeCellInteractions(ctx context.Context, batch *proto.CellComputeBatch) (*proto.CellComputeBatch, error) {
+	time.Sleep(f.delay)
+	if atomic.LoadInt32(&f.failing) == 1 {
+		return nil, errors.New("cis is failing")
+	}
+
+	f.lock.Lock()
+	f.timeStepsPerBatch[batch.BatchKey] = append(f.timeStepsPerBatch[batch.BatchKey], batch.TimeStep)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		f.traceparentsPerTimeStep[batch.TimeStep] = append(f.traceparentsPerTimeStep[batch.TimeStep], md.Get(tracing.TraceparentHeader)...)
+	}
+	f.lock.Unlock()
+
+	cells := []*proto.Cell{}
+	if f.lastTimeStep == 0 || batch.TimeStep < f.lastTimeStep {
+		for _, cell := range batch.CellsToCompute {
+			cells = append(cells, &proto.Cell{
+				Id:          cell.Id,
+				EnergyLevel: cell.EnergyLevel,
+				Pos:         &proto.Vector{X: cell.Pos.X + 1, Y: cell.Pos.Y, Z: cell.Pos.Z},
+			})
+		}
+	}
+	return &proto.CellComputeBatch{TimeStep: batch.TimeStep, BatchKey: batch.BatchKey, CellsToCompute: cells}, nil
+}
+
+//BigBang spawns the cells on a grid that fills 3x3x3 buckets of the width 500 of testServerConfig,
+//so the bucket in the middle has all of its neighbours and gets dispatched for the next step early
+func (f *fakeSlave) BigBang(request *proto.BigBangRequest, stream proto.CellInteractionService_BigBangServer) error {
+	for i := uint64(0); i < request.CellAmount; i++ {
+		cell := &proto.Cell{
+			Id:          fmt.Sprint(i),
+			EnergyLevel: request.EnergyLevel,
+			Pos:         &proto.Vector{X: float32(50 + i%20*70), Y: float32(75 + i/20%10*150), Z: float32(75 + i/200%10*150)},
+		}
+		if err := stream.Send(cell); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeSlave) register(t *testing.T, masterAddress net.Addr, threads uint32) {
+	conn, err := grpc.Dial(masterAddress.String(), grpc.WithInsecure())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err = proto.NewSlaveRegistrationServiceClient(conn).Register(ctx, &proto.SlaveRegistration{Address: f.address, Threads: threads})
+	require.NoError(t, err)
+}
+
+//timeStepsInOrder checks that every bucket was computed for increasing time steps
+func (f *fakeSlave) timeStepsInOrder(t *testing.T) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for key, timeSteps := range f.timeStepsPerBatch {
+		for i := 1; i < len(timeSteps); i++ {
+			assert.True(t, timeSteps[i-1] < timeSteps[i], "bucket %v was computed for time steps %v", key, timeSteps)
+		}
+	}
+}
+
+func testServerConfig() ServerConfig {
+	return ServerConfig{
+		ConnBufferSize:      100,
+		BigBangConfigPath:   "big_bang_config.yaml",
+		BucketWidth:         500,
+		HealthCheckInterval: 100 * time.Millisecond,
+		RetryPolicy: RetryPolicy{
+			MaxAttempts:       5,
+			InitialBackoff:    time.Millisecond,
+			MaxBackoff:        10 * time.Millisecond,
+			AttemptTimeout:    time.Second,
+			ClientWaitTimeout: 200 * time.Millisecond,
+		},
+	}
+}
+
+func startTestServer(t *testing.T, config ServerConfig, slaves ...*fakeSlave) *Server {
+	s := NewServer(config)
+
+	initDone := make(chan struct{})
+	go func() {
+		s.Init()
+		close(initDone)
+	}()
+	for _, slave := range slaves {
+		slave.register(t, s.GRPCAddr(), 2)
+	}
+
+	select {
+	case <-initDone:
+	case <-time.After(stepDeadlockTimeout):
+		t.Fatal("Init didn't finish")
+	}
+	return s
+}
+
+func stepWithin(t *testing.T, s *Server, timeout time.Duration) error {
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- s.step()
+	}()
+	select {
+	case err := <-errChan:
+		return err
+	case <-time.After(timeout):
+		t.Fatalf("step %v didn't finish within %v, the pipeline is deadlocked", s.TimeStep, timeout)
+		return nil
+	}
+}
+
+func cellIDs(buckets Buckets) map[string]bool {
+	ids := map[string]bool{}
+	for _, cell := range buckets.AllCells() {
+		ids[cell.Id] = true
+	}
+	return ids
+}
+
+func TestServerSimulation(t *testing.T) {
+	t.Run("steps conserve cells across fast, slow and failing slaves", func(t *testing.T) {
+		fast := startFakeSlave(t, 0)
+		slow := startFakeSlave(t, 20*time.Millisecond)
+		failing := startFakeSlave(t, 0)
+		failing.setFailing(true)
+		defer fast.grpcServer.Stop()
+		defer slow.grpcServer.Stop()
+		defer failing.grpcServer.Stop()
+
+		s := startTestServer(t, testServerConfig(), fast, slow, failing)
+		defer s.closeConnections()
+
+		initialIDs := cellIDs(s.CellBuckets)
+		require.Len(t, initialIDs, 2000)
+
+		for i := uint64(0); i < 10; i++ {
+			require.NoError(t, stepWithin(t, s, stepDeadlockTimeout))
+			assert.Equal(t, i+1, s.TimeStep)
+			assert.Len(t, s.CellBuckets.AllCells(), 2000)
+			assert.Equal(t, initialIDs, cellIDs(s.CellBuckets))
+		}
+
+		for key, cells := range s.CellBuckets {
+			for _, cell := range cells {
+				assert.Equal(t, key, bucketKeyFor(cell.Pos, 500))
+			}
+		}
+		fast.timeStepsInOrder(t)
+		slow.timeStepsInOrder(t)
+	})
+
+	t.Run("a step whose batches keep failing is rolled back and can be retried", func(t *testing.T) {
+		slave := startFakeSlave(t, 0)
+		defer slave.grpcServer.Stop()
+
+		s := startTestServer(t, testServerConfig(), slave)
+		defer s.closeConnections()
+
+		require.NoError(t, stepWithin(t, s, stepDeadlockTimeout))
+		cellsBefore := s.CellBuckets.AllCells()
+
+		slave.setFailing(true)
+		err := stepWithin(t, s, stepDeadlockTimeout)
+		require.Error(t, err)
+		assert.IsType(t, &BatchFailedError{}, err)
+		assert.Equal(t, uint64(1), s.TimeStep)
+		assert.ElementsMatch(t, cellsBefore, s.CellBuckets.AllCells())
+
+		slave.setFailing(false)
+		require.NoError(t, stepWithin(t, s, stepDeadlockTimeout))
+		assert.Equal(t, uint64(2), s.TimeStep)
+		assert.Len(t, s.CellBuckets.AllCells(), 2000)
+	})
+
+	t.Run("Run backs off between retries of a failing step", func(t *testing.T) {
+		defer cleanup()
+		slave := startFakeSlave(t, 0)
+		defer slave.grpcServer.Stop()
+
+		config := testServerConfig()
+		config.StatesDir = testStatesFolderName
+		config.RetryPolicy.MaxAttempts = 1
+		config.RetryPolicy.InitialBackoff = 50 * time.Millisecond
+		config.RetryPolicy.MaxBackoff = 400 * time.Millisecond
+		s := startTestServer(t, config, slave)
+		slave.setFailing(true)
+		runDone := runInBackground(s)
+
+		time.Sleep(500 * time.Millisecond)
+		s.signals <- os.Signal(syscall.SIGTERM)
+		select {
+		case <-runDone:
+		case <-time.After(stepDeadlockTimeout):
+			t.Fatal("Run didn't shut down while backing off")
+		}
+		// 50ms, 100ms, 200ms and 400ms of backoff leave time for at most 4 attempts of the step
+		assert.True(t, s.summary.FailedSteps > 0 && s.summary.FailedSteps <= 4, "%v failed steps", s.summary.FailedSteps)
+		assert.Equal(t, uint64(0), s.TimeStep)
+	})
+
+	t.Run("a slave that hangs gets evicted by the attempt timeout", func(t *testing.T) {
+		fast := startFakeSlave(t, 0)
+		hanging := startFakeSlave(t, 2*time.Second)
+		defer fast.grpcServer.Stop()
+		defer hanging.grpcServer.Stop()
+
+		config := testServerConfig()
+		config.HealthCheckInterval = 0
+		config.RetryPolicy.AttemptTimeout = 200 * time.Millisecond
+		s := startTestServer(t, config, fast, hanging)
+		defer s.closeConnections()
+
+		for i := 0; i < 3; i++ {
+			require.NoError(t, stepWithin(t, s, stepDeadlockTimeout))
+			assert.Len(t, s.CellBuckets.AllCells(), 2000)
+		}
+
+		s.cisClientPool.slaveLock.Lock()
+		defer s.cisClientPool.slaveLock.Unlock()
+		assert.True(t, s.cisClientPool.slaves[hanging.address].evictions > 0)
+		assert.Equal(t, 0, s.cisClientPool.slaves[fast.address].evictions)
+	})
+
+	t.Run("Run stops once no cells are remaining", func(t *testing.T) {
+		slave := startFakeSlave(t, 0)
+		slave.lastTimeStep = 5
+		defer slave.grpcServer.Stop()
+
+		s := startTestServer(t, testServerConfig(), slave)
+
+		runDone := make(chan struct{})
+		go func() {
+			s.Run()
+			close(runDone)
+		}()
+		select {
+		case <-runDone:
+		case <-time.After(stepDeadlockTimeout):
+			t.Fatal("Run didn't stop")
+		}
+		assert.Equal(t, uint64(6), s.TimeStep)
+		slave.timeStepsInOrder(t)
+	})
+}
+
+func TestPipelineMetrics(t *testing.T) {
+	slave := startFakeSlave(t, 0)
+	defer slave.grpcServer.Stop()
+
+	s := startTestServer(t, testServerConfig(), slave)
+	defer s.closeConnections()
+	require.Len(t, s.CellBuckets, 27)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, stepWithin(t, s, stepDeadlockTimeout))
+		assert.Len(t, s.CellBuckets.AllCells(), 2000, "cells are conserved across pipelined steps")
+	}
+	slave.timeStepsInOrder(t)
+
+	response, err := http.Get(fmt.Sprintf("http://%v/metrics", s.HTTPAddr()))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	body, err := ioutil.ReadAll(response.Body)
+	require.NoError(t, err)
+
+	for _, name := range []string{
+		"step_duration_seconds_count",
+		"step_batch_count_sum",
+		"step_predispatched_batch_count_sum",
+		"batch_cells_to_compute_count",
+		"batch_cells_in_proximity_sum",
+		"cis_call_retry_count",
+		"cis_client_wait_seconds_count",
+	} {
+		assert.Contains(t, string(body), "\n"+name+" ")
+	}
+	assert.NotContains(t, string(body), "\nstep_batch_count_sum 0\n")
+	assert.True(t, metricValue(t, string(body), "step_predispatched_batch_count_sum") > 0, "batches are dispatched for the next step early")
+}
+
+//metricValue of the sample with the given name in the prometheus text format
+func metricValue(t *testing.T, body, name string) float64 {
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, name+" ") {
+			value, err := strconv.ParseFloat(strings.TrimPrefix(line, name+" "), 64)
+			require.NoError(t, err)
+			return value
+		}
+	}
+	t.Fatalf("metric %v not found", name)
+	return 0
+}
+
+type recordingExporter struct {
+	lock  sync.Mutex
+	spans []*tracing.Span
+}
+
+func (e *recordingExporter) ExportSpan(span *tracing.Span) {
+	e.lock.Lock()
+	e.spans = append(e.spans, span)
+	e.lock.Unlock()
+}
+
+func (e *recordingExporter) Close() error {
+	return nil
+}
+
+func TestStepTracing(t *testing.T) {
+	slave := startFakeSlave(t, 0)
+	defer slave.grpcServer.Stop()
+
+	exporter := &recordingExporter{}
+	config := testServerConfig()
+	config.TraceExporter = exporter
+	s := startTestServer(t, config, slave)
+	require.NoError(t, stepWithin(t, s, stepDeadlockTimeout))
+	defer s.closeConnections()
+
+	exporter.lock.Lock()
+	defer exporter.lock.Unlock()
+	spansByName := map[string][]*tracing.Span{}
+	spansByID := map[tracing.SpanID]*tracing.Span{}
+	for _, span := range exporter.spans {
+		spansByName[span.Name] = append(spansByName[span.Name], span)
+		spansByID[span.SpanID] = span
+	}
+	require.Len(t, spansByName["step"], 1)
+	step := spansByName["step"][0]
+	assert.Equal(t, uint64(0), step.Attributes["time_step"])
+	require.Len(t, spansByName["merge"], 1)
+	assert.Equal(t, step.SpanID, spansByName["merge"][0].ParentSpanID)
+
+	require.NotEmpty(t, spansByName["callCIS"])
+	for _, call := range spansByName["callCIS"] {
+		assert.Equal(t, step.TraceID, call.TraceID)
+		assert.Contains(t, call.Attributes, "bucket_key")
+		assert.Contains(t, call.Attributes, "cells_to_compute")
+		assert.Contains(t, call.Attributes, "cells_in_proximity")
+	}
+
+	slave.lock.Lock()
+	defer slave.lock.Unlock()
+	// batches of the next time step that were dispatched early may still be inflight
+	require.NotEmpty(t, slave.traceparentsPerTimeStep[0])
+	for _, traceparent := range slave.traceparentsPerTimeStep[0] {
+		spanContext, err := tracing.ParseTraceparent(traceparent)
+		require.NoError(t, err)
+		attempt, ok := spansByID[spanContext.SpanID]
+		require.True(t, ok, "the traceparent %v belongs to an exported span", traceparent)
+		assert.Equal(t, "computeBatch", attempt.Name)
+		assert.Equal(t, slave.address, attempt.Attributes["slave_address"])
+		assert.IsType(t, 0, attempt.Attributes["attempt"])
+		assert.Equal(t, "callCIS", spansByID[attempt.ParentSpanID].Name)
+	}
+}
@@ -0,0 +1,85 @@
+package master
+
+import (
+	"os"
+	"time"
+)
+
+//beginShutdown after received. From now on a second signal exits the process right away
+func (s *Server) beginShutdown(received os.Signal) {
+	serverLogger.With("signal", received).With("time_step", s.TimeStep).Info("received signal, shutting down")
+	go s.exitOnSecondSignal()
+}
+
+//exitOnSecondSignal received before Run returned, without saving anything
+func (s *Server) exitOnSecondSignal() {
+	select {
+	case received := <-s.signals:
+		serverLogger.With("signal", received).With("time_step", s.TimeStep).Error("received second signal, exiting without saving")
+		s.exit(1)
+	case <-s.runDone:
+	}
+}
+
+//runStep makes a step while watching for signals. If one is received, the step gets the ShutdownGracePeriod to finish
+//before its inflight cis calls are cancelled. Either way the step is complete or rolled back once runStep returns
+func (s *Server) runStep() (os.Signal, error) {
+	stepDone := make(chan error, 1)
+	go func() {
+		stepDone <- s.step()
+	}()
+
+	select {
+	case err := <-stepDone:
+		return nil, err
+	case received := <-s.signals:
+		s.beginShutdown(received)
+		return received, s.drainStep(stepDone)
+	}
+}
+
+//drainStep waits up to the ShutdownGracePeriod for the running step, then cancels its inflight cis calls
+func (s *Server) drainStep(stepDone <-chan error) error {
+	timer := time.NewTimer(s.ShutdownGracePeriod)
+	defer timer.Stop()
+
+	select {
+	case err := <-stepDone:
+		return err
+	case <-timer.C:
+		serverLogger.With("time_step", s.TimeStep).With("grace_period", s.ShutdownGracePeriod).Warn("step didn't finish within the grace period, cancelling inflight cis calls")
+		s.cancel()
+		return <-stepDone
+	}
+}
+
+//discardInflightBatches that were dispatched for the time step after the current one, once s.ctx is cancelled.
+//Their results would never be merged, but they would still be recorded in the journal
+func (s *Server) discardInflightBatches() {
+	waitGroup := s.CurrentWaitGroup()
+	returnedBatchChan := s.CurrentReturnedBatchChan()
+	go func() {
+		waitGroup.Wait()
+		close(returnedBatchChan)
+	}()
+	for range returnedBatchChan {
+	}
+}
+
+//stopGRPCServer lets pending rpcs finish within the ShutdownGracePeriod before closing their connections
+func (s *Server) stopGRPCServer() {
+	stopped := make(chan struct{})
+	go func() {
+		s.grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	timer := time.NewTimer(s.ShutdownGracePeriod)
+	defer timer.Stop()
+	select {
+	case <-stopped:
+	case <-timer.C:
+		s.grpcServer.Stop()
+		<-stopped
+	}
+}
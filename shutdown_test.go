@@ -0,0 +1,131 @@
+package master
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//blockingStateStore blocks every Save until release is closed
+type blockingStateStore struct {
+	StateStore
+	saving  chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingStateStore) Save(name string, s *SimulationState) error {
+	select {
+	case b.saving <- struct{}{}:
+	default:
+	}
+	<-b.release
+	return b.StateStore.Save(name, s)
+}
+
+func runInBackground(s *Server) chan struct{} {
+	runDone := make(chan struct{})
+	go func() {
+		s.Run()
+		close(runDone)
+	}()
+	return runDone
+}
+
+func TestGracefulShutdown(t *testing.T) {
+	t.Run("a step that doesn't finish within the grace period is cancelled and rolled back", func(t *testing.T) {
+		defer cleanup()
+		slave := startFakeSlave(t, 2*time.Second)
+		defer slave.grpcServer.Stop()
+
+		config := testServerConfig()
+		config.StatesDir = testStatesFolderName
+		config.ShutdownGracePeriod = 100 * time.Millisecond
+		s := startTestServer(t, config, slave)
+		runDone := runInBackground(s)
+
+		time.Sleep(200 * time.Millisecond)
+		signaledAt := time.Now()
+		s.signals <- os.Signal(syscall.SIGTERM)
+		select {
+		case <-runDone:
+		case <-time.After(stepDeadlockTimeout):
+			t.Fatal("Run didn't return after a signal")
+		}
+		assert.True(t, time.Since(signaledAt) < time.Second, "the step was cancelled after %v", time.Since(signaledAt))
+
+		assert.Equal(t, uint64(0), s.TimeStep)
+		saved, err := LoadLatestState(s.StateStore)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(0), saved.TimeStep)
+		assert.Len(t, saved.CellBuckets.AllCells(), 2000)
+	})
+
+	t.Run("a step that finishes within the grace period is saved", func(t *testing.T) {
+		defer cleanup()
+		slave := startFakeSlave(t, 100*time.Millisecond)
+		defer slave.grpcServer.Stop()
+
+		config := testServerConfig()
+		config.StatesDir = testStatesFolderName
+		config.ShutdownGracePeriod = 5 * time.Second
+		// the batches of a step queue for the two clients of the slave
+		config.RetryPolicy.ClientWaitTimeout = 5 * time.Second
+		s := startTestServer(t, config, slave)
+		runDone := runInBackground(s)
+
+		time.Sleep(50 * time.Millisecond)
+		s.signals <- os.Signal(syscall.SIGTERM)
+		select {
+		case <-runDone:
+		case <-time.After(stepDeadlockTimeout):
+			t.Fatal("Run didn't return after a signal")
+		}
+
+		assert.True(t, s.TimeStep >= 1, "the running step was finished")
+		saved, err := LoadLatestState(s.StateStore)
+		require.NoError(t, err)
+		assert.Equal(t, s.TimeStep, saved.TimeStep)
+		assert.Len(t, saved.CellBuckets.AllCells(), 2000)
+	})
+
+	t.Run("a second signal exits without waiting for the save", func(t *testing.T) {
+		defer cleanup()
+		slave := startFakeSlave(t, 0)
+		defer slave.grpcServer.Stop()
+
+		store := &blockingStateStore{
+			StateStore: NewFileStateStore(testStatesFolderName),
+			saving:     make(chan struct{}, 1),
+			release:    make(chan struct{}),
+		}
+		config := testServerConfig()
+		config.StateStore = store
+		s := startTestServer(t, config, slave)
+		exitCodes := make(chan int, 1)
+		s.exit = func(code int) {
+			exitCodes <- code
+		}
+		runDone := runInBackground(s)
+
+		s.signals <- os.Signal(syscall.SIGTERM)
+		select {
+		case <-store.saving:
+		case <-time.After(stepDeadlockTimeout):
+			t.Fatal("the state wasn't saved after a signal")
+		}
+		s.signals <- os.Signal(syscall.SIGINT)
+		select {
+		case code := <-exitCodes:
+			assert.Equal(t, 1, code)
+		case <-time.After(stepDeadlockTimeout):
+			t.Fatal("a second signal didn't exit")
+		}
+
+		close(store.release)
+		<-runDone
+	})
+}
@@ -1,15 +1,13 @@
 package master
 
 import (
-	"encoding/gob"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
-	"time"
 
 	proto "github.com/codeuniversity/al-proto"
 )
@@ -18,17 +16,36 @@ import (
 type SimulationState struct {
 	CellBuckets Buckets
 	TimeStep    uint64
+	//CellBucketWidth is the bucket width the CellBuckets were created with
+	CellBucketWidth int
+	//BigBangConfig the simulation was started with, nil if unknown
+	BigBangConfig *BigBangConfig
 
 	currentBucketRequestsInflight map[BucketKey]bool
 	nextBucketRequestsInflight    map[BucketKey]bool
 
-	currentReturnedBatchChan chan *proto.CellComputeBatch
-	nextReturnedBatchChan    chan *proto.CellComputeBatch
+	currentReturnedBatchChan chan *BatchResult
+	nextReturnedBatchChan    chan *BatchResult
 
 	currentWaitGroup *sync.WaitGroup
 	nextWaitGroup    *sync.WaitGroup
 }
 
+//BatchResult is either the batch returned by cis or the error that made computing the batch fail
+type BatchResult struct {
+	Batch *proto.CellComputeBatch
+	Err   error
+}
+
+//Rebucket the cells if the state was bucketed with a different width
+func (s *SimulationState) Rebucket(bucketWidth int) {
+	if s.CellBucketWidth == bucketWidth {
+		return
+	}
+	s.CellBuckets = CreateBuckets(s.CellBuckets.AllCells(), uint(bucketWidth))
+	s.CellBucketWidth = bucketWidth
+}
+
 //NewSimulationState with internal fields initialized
 func NewSimulationState(buckets Buckets) *SimulationState {
 	state := &SimulationState{
@@ -39,32 +56,34 @@ func NewSimulationState(buckets Buckets) *SimulationState {
 	return state
 }
 
-//LoadSimulationState from file
+//LoadSimulationState from file, which may be in the versioned or the legacy gob format
 func LoadSimulationState(statePath string) (*SimulationState, error) {
 	file, err := os.Open(statePath)
 	if err != nil {
 		return nil, err
 	}
-	s := &SimulationState{}
-	decoder := gob.NewDecoder(file)
-	err = decoder.Decode(s)
+	s, err := ReadState(file)
 	if err != nil {
+		file.Close()
 		return nil, err
 	}
 
-	s.intializeComplexFields()
-
 	return s, file.Close()
 }
 
-//LoadLatestSimulationState from file
-func LoadLatestSimulationState() (*SimulationState, error) {
-	files, err := ioutil.ReadDir(filepath.Join(statesFolderName))
-	if err != nil {
-		return nil, err
-	}
-	latestStateName := nameOfLatestState(files)
-	return LoadSimulationState(filepath.Join(statesFolderName, latestStateName))
+//LoadLatestSimulationState from the states in folder
+func LoadLatestSimulationState(folder string) (*SimulationState, error) {
+	return LoadLatestState(NewFileStateStore(folder))
+}
+
+//LatestStateName in folder
+func LatestStateName(folder string) (string, error) {
+	return NewFileStateStore(folder).Latest()
+}
+
+//StateNames in folder, oldest first
+func StateNames(folder string) ([]string, error) {
+	return NewFileStateStore(folder).List()
 }
 
 //MarkRequestInflight will panic if the key was set to inflight before
@@ -88,12 +107,12 @@ func (s *SimulationState) RequestInflight(key BucketKey) bool {
 }
 
 //CurrentReturnedBatchChan ...
-func (s *SimulationState) CurrentReturnedBatchChan() chan *proto.CellComputeBatch {
+func (s *SimulationState) CurrentReturnedBatchChan() chan *BatchResult {
 	return s.currentReturnedBatchChan
 }
 
 //NextReturnedBatchChan ...
-func (s *SimulationState) NextReturnedBatchChan() chan *proto.CellComputeBatch {
+func (s *SimulationState) NextReturnedBatchChan() chan *BatchResult {
 	return s.nextReturnedBatchChan
 }
 
@@ -107,78 +126,123 @@ func (s *SimulationState) NextWaitGroup() *sync.WaitGroup {
 	return s.nextWaitGroup
 }
 
-//Cycle closes the current channel, set it and the current waitgroup to the next one and create a new next ones
-func (s *SimulationState) Cycle() {
+//CloseCurrentReturnedBatchChan signals that all batches of the current step have been returned
+func (s *SimulationState) CloseCurrentReturnedBatchChan() {
 	close(s.currentReturnedBatchChan)
+}
+
+//Cycle sets the current channel, inflight requests and waitgroup to the next ones and creates new next ones.
+//The current channel has to be closed and all of its batches processed before calling Cycle
+func (s *SimulationState) Cycle() {
 	s.currentBucketRequestsInflight = s.nextBucketRequestsInflight
 	s.nextBucketRequestsInflight = map[BucketKey]bool{}
 
 	s.currentReturnedBatchChan = s.nextReturnedBatchChan
-	s.nextReturnedBatchChan = make(chan *proto.CellComputeBatch)
+	s.nextReturnedBatchChan = make(chan *BatchResult)
 
+	s.currentWaitGroup = s.nextWaitGroup
+	s.nextWaitGroup = &sync.WaitGroup{}
+}
+
+//DiscardNextStep drops all batches that were already requested for the next step
+//and resets the pipeline, so the current step can be computed again from scratch
+func (s *SimulationState) DiscardNextStep() {
+	nextWaitGroup := s.nextWaitGroup
+	nextReturnedBatchChan := s.nextReturnedBatchChan
+	go func() {
+		nextWaitGroup.Wait()
+		close(nextReturnedBatchChan)
+	}()
+	for range nextReturnedBatchChan {
+	}
+
+	s.intializeComplexFields()
 }
 
 func (s *SimulationState) intializeComplexFields() {
 	s.currentBucketRequestsInflight = map[BucketKey]bool{}
 	s.nextBucketRequestsInflight = map[BucketKey]bool{}
 
-	s.currentReturnedBatchChan = make(chan *proto.CellComputeBatch)
-	s.nextReturnedBatchChan = make(chan *proto.CellComputeBatch)
+	s.currentReturnedBatchChan = make(chan *BatchResult)
+	s.nextReturnedBatchChan = make(chan *BatchResult)
 	s.currentWaitGroup = &sync.WaitGroup{}
 	s.nextWaitGroup = &sync.WaitGroup{}
 }
 
-func (s *SimulationState) saveState() error {
-	saveTime := time.Now()
-	err := os.MkdirAll(statesFolderName, 0755)
-	if err != nil {
-		return err
+//pruneStates removes the oldest states of store until only keep states are left. keep <= 0 keeps all states
+func pruneStates(store StateStore, keep int) error {
+	if keep <= 0 {
+		return nil
 	}
-	temporaryPath := buildTemporaryStateFilePath(saveTime)
-	file, err := os.Create(temporaryPath)
+	stateNames, err := store.List()
 	if err != nil {
 		return err
 	}
-	encoder := gob.NewEncoder(file)
-	err = encoder.Encode(s)
-	if err != nil {
-		return err
+
+	for len(stateNames) > keep {
+		if err := store.Delete(stateNames[0]); err != nil {
+			return err
+		}
+		stateNames = stateNames[1:]
 	}
-	err = file.Close()
-	if err != nil {
-		return err
+	return nil
+}
+
+//sortStateNames returns the valid state names of names, oldest first
+func sortStateNames(names []string) []string {
+	stateNames := []string{}
+	for _, name := range names {
+		if stateNameValid(name) {
+			stateNames = append(stateNames, name)
+		}
 	}
-	return os.Rename(temporaryPath, buildStateFilePath(saveTime))
+	sort.Slice(stateNames, func(i, j int) bool {
+		return stateNameBefore(stateNames[i], stateNames[j])
+	})
+	return stateNames
 }
 
 func nameOfLatestState(files []os.FileInfo) (latestStateName string) {
-	var latestStateInt int64
-
 	for _, f := range files {
 		stateName := f.Name()
-		stateInt, _ := stateNameToInt(stateName)
-
-		if stateNameValid(stateName) && stateInt > latestStateInt {
+		if stateNameValid(stateName) && (latestStateName == "" || stateNameBefore(latestStateName, stateName)) {
 			latestStateName = stateName
-			latestStateInt = stateInt
 		}
 	}
 	return
 }
 
+var validStateName = regexp.MustCompile(`^STATE_\d+(_\d{9})?$`)
+
 func stateNameValid(stateName string) bool {
-	var validStateName = regexp.MustCompile(`STATE_\d+`)
 	return validStateName.MatchString(stateName)
 }
 
-func stateNameToInt(stateName string) (int64, error) {
-	return strconv.ParseInt(stateName[6:], 10, 64)
+//stateNameBefore if the state named first was saved before the state named second.
+//Names without nanoseconds come first within their second
+func stateNameBefore(first, second string) bool {
+	firstSeconds, _ := stateNameToInt(first)
+	secondSeconds, _ := stateNameToInt(second)
+	if firstSeconds != secondSeconds {
+		return firstSeconds < secondSeconds
+	}
+	return stateNameNanoseconds(first) < stateNameNanoseconds(second)
 }
 
-func buildStateFilePath(saveTime time.Time) string {
-	return filepath.Join(statesFolderName, "STATE_"+string(saveTime.Format("20060102150405")))
+//stateNameToInt parses the seconds of the state name, without its nanoseconds
+func stateNameToInt(stateName string) (int64, error) {
+	seconds := stateName[6:]
+	if i := strings.IndexByte(seconds, '_'); i >= 0 {
+		seconds = seconds[:i]
+	}
+	return strconv.ParseInt(seconds, 10, 64)
 }
 
-func buildTemporaryStateFilePath(saveTime time.Time) string {
-	return filepath.Join(statesFolderName, "SAVING_"+string(saveTime.Format("20060102150405")))
+func stateNameNanoseconds(stateName string) int64 {
+	i := strings.IndexByte(stateName[6:], '_')
+	if i < 0 {
+		return 0
+	}
+	nanoseconds, _ := strconv.ParseInt(stateName[6+i+1:], 10, 64)
+	return nanoseconds
 }
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -35,6 +36,29 @@ func TestNameOfLatestState(t *testing.T) {
 	assert.Equal(t, "STATE_20190222194317", nameOfLatestState(files))
 }
 
+func TestStateNamesWithinTheSameSecond(t *testing.T) {
+	saveTime := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+	first := StateName(saveTime.Add(5 * time.Millisecond))
+	second := StateName(saveTime.Add(900 * time.Millisecond))
+	assert.Equal(t, "STATE_20190301120000_005000000", first)
+	assert.NotEqual(t, first, second)
+	assert.True(t, stateNameValid(first))
+
+	names := []string{second, "STATE_20190301120001", first, "STATE_20190301120000"}
+	assert.Equal(t, []string{"STATE_20190301120000", first, second, "STATE_20190301120001"}, sortStateNames(names))
+
+	defer cleanup()
+	assert.NoError(t, os.MkdirAll(testStatesFolderName, 0755))
+	for _, name := range []string{first, second, "STATE_20190301120000"} {
+		file, err := os.Create(filepath.Join(testStatesFolderName, name))
+		assert.NoError(t, err)
+		file.Close()
+	}
+	files, err := ioutil.ReadDir(testStatesFolderName)
+	assert.NoError(t, err)
+	assert.Equal(t, second, nameOfLatestState(files))
+}
+
 func TestStateNameValid(t *testing.T) {
 	t.Run("with valid state name", func(t *testing.T) {
 		stateName := "STATE_20190222194317"
@@ -58,3 +82,25 @@ func TestStateNameToInt(t *testing.T) {
 		assert.Equal(t, int64(0), stateInt)
 	})
 }
+
+func TestPruneStates(t *testing.T) {
+	defer cleanup()
+
+	err := os.MkdirAll(testStatesFolderName, 0755)
+	assert.NoError(t, err)
+	for _, name := range []string{"STATE_20190222194317", "STATE_20190222194284", "STATE_20190223000000", "SAVING_20190101000000"} {
+		file, err := os.Create(filepath.Join(testStatesFolderName, name))
+		assert.NoError(t, err)
+		file.Close()
+	}
+
+	assert.NoError(t, pruneStates(NewFileStateStore(testStatesFolderName), 2))
+
+	files, err := ioutil.ReadDir(testStatesFolderName)
+	assert.NoError(t, err)
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	assert.Equal(t, []string{"SAVING_20190101000000", "STATE_20190222194317", "STATE_20190223000000"}, names)
+}
@@ -0,0 +1,419 @@
+package master
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	protobuf "github.com/golang/protobuf/proto"
+
+	"github.com/codeuniversity/al-proto"
+)
+
+//stateFileMagic starts every state file that isn't a legacy gob file
+const stateFileMagic = "ALSTATE\n"
+
+//StateFormatVersion is the version of the state file format that is written
+const StateFormatVersion = 2
+
+//maxStateHeaderLength and maxStateRecordLength bound the lengths read from a state file,
+//so a corrupt file fails to load instead of allocating whatever length it claims
+const (
+	maxStateHeaderLength = 1 << 20
+	maxStateRecordLength = 16 << 20
+)
+
+//StateHeader describes a saved state without having to read its cells
+type StateHeader struct {
+	FormatVersion uint32         `json:"format_version"`
+	TimeStep      uint64         `json:"time_step"`
+	BucketWidth   int            `json:"bucket_width"`
+	BigBangConfig *BigBangConfig `json:"big_bang_config,omitempty"`
+	CellCount     uint64         `json:"cell_count"`
+	BucketCount   uint64         `json:"bucket_count"`
+	CreatedAt     time.Time      `json:"created_at"`
+}
+
+//WriteState in the versioned state file format:
+//the magic "ALSTATE\n", the format version and the length of the header as big endian uint32 and the header as JSON.
+//The header is followed by a gzip stream that holds the buckets one by one,
+//each as varint length prefixed bucket key, varint cell count and varint length delimited proto.Cell records
+func WriteState(w io.Writer, s *SimulationState, createdAt time.Time) error {
+	cellCount := 0
+	for _, cells := range s.CellBuckets {
+		cellCount += len(cells)
+	}
+	header, err := json.Marshal(&StateHeader{
+		FormatVersion: StateFormatVersion,
+		TimeStep:      s.TimeStep,
+		BucketWidth:   s.CellBucketWidth,
+		BigBangConfig: s.BigBangConfig,
+		CellCount:     uint64(cellCount),
+		BucketCount:   uint64(len(s.CellBuckets)),
+		CreatedAt:     createdAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(w)
+	if _, err := writer.WriteString(stateFileMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(writer, binary.BigEndian, uint32(StateFormatVersion)); err != nil {
+		return err
+	}
+	if err := binary.Write(writer, binary.BigEndian, uint32(len(header))); err != nil {
+		return err
+	}
+	if _, err := writer.Write(header); err != nil {
+		return err
+	}
+
+	compressor, err := gzip.NewWriterLevel(writer, gzip.BestSpeed)
+	if err != nil {
+		return err
+	}
+	body := &stateBodyWriter{writer: compressor}
+	for key, cells := range s.CellBuckets {
+		body.writeBytes([]byte(key))
+		body.writeUvarint(uint64(len(cells)))
+		for _, cell := range cells {
+			body.writeCell(cell)
+		}
+	}
+	if body.err != nil {
+		return body.err
+	}
+	if err := compressor.Close(); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+//ReadState in the versioned state file format or from a legacy gob encoded SimulationState.
+//The cells are decoded while reading, so the file is never held in memory as a whole
+func ReadState(r io.Reader) (*SimulationState, error) {
+	reader := bufio.NewReader(r)
+	isVersioned, err := hasStateFileMagic(reader)
+	if err != nil {
+		return nil, err
+	}
+	if !isVersioned {
+		return readLegacyState(reader)
+	}
+
+	header, err := readStateHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	var buckets Buckets
+	if header.FormatVersion == 1 {
+		buckets, err = readUncompressedCells(reader, header)
+	} else {
+		buckets, err = readCompressedBuckets(reader, header)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewSimulationState(buckets)
+	s.TimeStep = header.TimeStep
+	s.CellBucketWidth = header.BucketWidth
+	s.BigBangConfig = header.BigBangConfig
+	return s, nil
+}
+
+//ReadStateHeader of the state file at path without reading its cells.
+//Legacy gob files have no header, so they are fully decoded to build one
+func ReadStateHeader(path string) (*StateHeader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	isVersioned, err := hasStateFileMagic(reader)
+	if err != nil {
+		return nil, err
+	}
+	if isVersioned {
+		return readStateHeader(reader)
+	}
+
+	s, err := readLegacyState(reader)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &StateHeader{
+		TimeStep:    s.TimeStep,
+		CellCount:   uint64(len(s.CellBuckets.AllCells())),
+		BucketCount: uint64(len(s.CellBuckets)),
+		CreatedAt:   info.ModTime(),
+	}, nil
+}
+
+//MigrateStateFile rewrites a legacy gob state file in the current format. Versioned files are left as they are,
+//older versions can still be read and are replaced by the current version with the next checkpoint
+func MigrateStateFile(path string, bucketWidth int) (migrated bool, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	reader := bufio.NewReader(file)
+	isVersioned, err := hasStateFileMagic(reader)
+	if err != nil || isVersioned {
+		file.Close()
+		return false, err
+	}
+	s, err := readLegacyState(reader)
+	file.Close()
+	if err != nil {
+		return false, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	s.CellBucketWidth = bucketWidth
+	temporaryPath := filepath.Join(filepath.Dir(path), "SAVING_"+filepath.Base(path))
+	if err := writeStateFile(temporaryPath, s, info.ModTime()); err != nil {
+		return false, err
+	}
+	return true, os.Rename(temporaryPath, path)
+}
+
+//MigrateStates rewrites every legacy state file in folder and returns the names of the migrated files
+func MigrateStates(folder string, bucketWidth int) ([]string, error) {
+	files, err := ioutil.ReadDir(folder)
+	if err != nil {
+		return nil, err
+	}
+	migratedFiles := []string{}
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), "STATE_") {
+			continue
+		}
+		migrated, err := MigrateStateFile(filepath.Join(folder, file.Name()), bucketWidth)
+		if err != nil {
+			return migratedFiles, fmt.Errorf("migrating %v failed: %v", file.Name(), err)
+		}
+		if migrated {
+			migratedFiles = append(migratedFiles, file.Name())
+		}
+	}
+	return migratedFiles, nil
+}
+
+func writeStateFile(path string, s *SimulationState, createdAt time.Time) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := WriteState(file, s, createdAt); err != nil {
+		file.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
+
+func hasStateFileMagic(reader *bufio.Reader) (bool, error) {
+	magic, err := reader.Peek(len(stateFileMagic))
+	if err == io.EOF || err == bufio.ErrBufferFull {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return string(magic) == stateFileMagic, nil
+}
+
+func readStateHeader(reader *bufio.Reader) (*StateHeader, error) {
+	if _, err := reader.Discard(len(stateFileMagic)); err != nil {
+		return nil, err
+	}
+	var version, headerLength uint32
+	if err := binary.Read(reader, binary.BigEndian, &version); err != nil {
+		return nil, truncatedState(err)
+	}
+	if version == 0 || version > StateFormatVersion {
+		return nil, fmt.Errorf("state file format version %v is not supported", version)
+	}
+	if err := binary.Read(reader, binary.BigEndian, &headerLength); err != nil {
+		return nil, truncatedState(err)
+	}
+	if headerLength > maxStateHeaderLength {
+		return nil, fmt.Errorf("state file header of %v bytes is longer than the maximum of %v bytes", headerLength, maxStateHeaderLength)
+	}
+	headerData := make([]byte, headerLength)
+	if _, err := io.ReadFull(reader, headerData); err != nil {
+		return nil, truncatedState(err)
+	}
+	header := &StateHeader{}
+	if err := json.Unmarshal(headerData, header); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+//readCompressedBuckets of the gzip stream of a version 2 state file
+func readCompressedBuckets(reader io.Reader, header *StateHeader) (Buckets, error) {
+	decompressor, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, truncatedState(err)
+	}
+	defer decompressor.Close()
+	body := &stateBodyReader{reader: bufio.NewReader(decompressor)}
+
+	//the counts of the file are not trusted as capacities, the buckets and cells grow as they are read
+	buckets := Buckets{}
+	for i := uint64(0); i < header.BucketCount; i++ {
+		key := BucketKey(body.readBytes())
+		cellCount := body.readUvarint()
+		if body.err != nil {
+			return nil, body.err
+		}
+		cells := []*proto.Cell{}
+		for j := uint64(0); j < cellCount && body.err == nil; j++ {
+			cells = append(cells, body.readCell())
+		}
+		if body.err != nil {
+			return nil, body.err
+		}
+		buckets[key] = cells
+	}
+	//reading up to the end of the stream verifies the gzip checksum
+	if _, err := body.reader.ReadByte(); err != io.EOF {
+		if err == nil {
+			return nil, errors.New("state file has data after its last bucket")
+		}
+		return nil, truncatedState(err)
+	}
+	return buckets, nil
+}
+
+//readUncompressedCells of a version 1 state file, which stores the cells without their buckets
+func readUncompressedCells(reader *bufio.Reader, header *StateHeader) (Buckets, error) {
+	body := &stateBodyReader{reader: reader}
+	cells := []*proto.Cell{}
+	for i := uint64(0); i < header.CellCount && body.err == nil; i++ {
+		cells = append(cells, body.readCell())
+	}
+	if body.err != nil {
+		return nil, body.err
+	}
+	return CreateBuckets(cells, uint(header.BucketWidth)), nil
+}
+
+//stateBodyWriter keeps the first error, so the records can be written without checking each of them
+type stateBodyWriter struct {
+	writer io.Writer
+	buffer []byte
+	err    error
+}
+
+func (w *stateBodyWriter) writeUvarint(value uint64) {
+	if w.err != nil {
+		return
+	}
+	var prefix [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(prefix[:], value)
+	_, w.err = w.writer.Write(prefix[:n])
+}
+
+func (w *stateBodyWriter) writeBytes(data []byte) {
+	w.writeUvarint(uint64(len(data)))
+	if w.err != nil {
+		return
+	}
+	_, w.err = w.writer.Write(data)
+}
+
+func (w *stateBodyWriter) writeCell(cell *proto.Cell) {
+	if w.err != nil {
+		return
+	}
+	buffer := protobuf.NewBuffer(w.buffer[:0])
+	if w.err = buffer.Marshal(cell); w.err != nil {
+		return
+	}
+	w.buffer = buffer.Bytes()
+	w.writeBytes(w.buffer)
+}
+
+//stateBodyReader keeps the first error like stateBodyWriter, returning zero values after it
+type stateBodyReader struct {
+	reader *bufio.Reader
+	err    error
+}
+
+func (r *stateBodyReader) readUvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	value, err := binary.ReadUvarint(r.reader)
+	r.err = truncatedState(err)
+	return value
+}
+
+func (r *stateBodyReader) readBytes() []byte {
+	length := r.readUvarint()
+	if r.err != nil {
+		return nil
+	}
+	if length > maxStateRecordLength {
+		r.err = fmt.Errorf("state file record of %v bytes is longer than the maximum of %v bytes", length, maxStateRecordLength)
+		return nil
+	}
+	data := make([]byte, length)
+	_, err := io.ReadFull(r.reader, data)
+	r.err = truncatedState(err)
+	return data
+}
+
+func (r *stateBodyReader) readCell() *proto.Cell {
+	data := r.readBytes()
+	if r.err != nil {
+		return nil
+	}
+	cell := &proto.Cell{}
+	r.err = protobuf.Unmarshal(data, cell)
+	return cell
+}
+
+func readLegacyState(reader io.Reader) (*SimulationState, error) {
+	s := &SimulationState{}
+	if err := gob.NewDecoder(reader).Decode(s); err != nil {
+		return nil, err
+	}
+	s.intializeComplexFields()
+	return s, nil
+}
+
+func truncatedState(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errors.New("state file ends unexpectedly")
+	}
+	return err
+}
@@ -0,0 +1,231 @@
+package master
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	protobuf "github.com/golang/protobuf/proto"
+
+	"github.com/codeuniversity/al-proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testState() *SimulationState {
+	cells := []*proto.Cell{
+		{Id: "a", EnergyLevel: 3, Pos: &proto.Vector{X: 10, Y: 20, Z: 30}},
+		{Id: "b", EnergyLevel: 5, Pos: &proto.Vector{X: -700, Y: 20, Z: 1200}},
+	}
+	s := NewSimulationState(CreateBuckets(cells, 500))
+	s.TimeStep = 42
+	s.CellBucketWidth = 500
+	s.BigBangConfig = &BigBangConfig{CellAmount: 2, EnergyLevel: 3}
+	return s
+}
+
+func writeLegacyState(t *testing.T, path string, s *SimulationState) {
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+	require.NoError(t, gob.NewEncoder(file).Encode(&struct {
+		CellBuckets Buckets
+		TimeStep    uint64
+	}{s.CellBuckets, s.TimeStep}))
+}
+
+//assertSameBuckets compares the cells with protobuf.Equal, since decoded cells differ in their internal fields
+func assertSameBuckets(t *testing.T, expected, actual Buckets) {
+	require.Len(t, actual, len(expected))
+	for key, cells := range expected {
+		require.Len(t, actual[key], len(cells), "bucket %v", key)
+		for i, cell := range cells {
+			assert.True(t, protobuf.Equal(cell, actual[key][i]), "expected %v, got %v", cell, actual[key][i])
+		}
+	}
+}
+
+func TestStateFile(t *testing.T) {
+	createdAt := time.Date(2019, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	t.Run("round trip", func(t *testing.T) {
+		s := testState()
+		buffer := &bytes.Buffer{}
+		require.NoError(t, WriteState(buffer, s, createdAt))
+
+		loaded, err := ReadState(buffer)
+		require.NoError(t, err)
+		assert.Equal(t, s.TimeStep, loaded.TimeStep)
+		assert.Equal(t, s.CellBucketWidth, loaded.CellBucketWidth)
+		assert.Equal(t, s.BigBangConfig, loaded.BigBangConfig)
+		assertSameBuckets(t, s.CellBuckets, loaded.CellBuckets)
+		assert.NotNil(t, loaded.CurrentWaitGroup())
+	})
+
+	t.Run("truncated files fail to load", func(t *testing.T) {
+		buffer := &bytes.Buffer{}
+		require.NoError(t, WriteState(buffer, testState(), createdAt))
+
+		_, err := ReadState(bytes.NewReader(buffer.Bytes()[:buffer.Len()-3]))
+		assert.Error(t, err)
+	})
+
+	t.Run("corrupt lengths fail to load without allocating them", func(t *testing.T) {
+		versionedState := func(header *StateHeader, headerLength uint32, body func(body *stateBodyWriter)) *bytes.Buffer {
+			headerData, err := json.Marshal(header)
+			require.NoError(t, err)
+			if headerLength == 0 {
+				headerLength = uint32(len(headerData))
+			}
+			buffer := bytes.NewBufferString(stateFileMagic)
+			require.NoError(t, binary.Write(buffer, binary.BigEndian, []uint32{header.FormatVersion, headerLength}))
+			buffer.Write(headerData)
+			compressor := gzip.NewWriter(buffer)
+			writer := &stateBodyWriter{writer: compressor}
+			body(writer)
+			require.NoError(t, writer.err)
+			require.NoError(t, compressor.Close())
+			return buffer
+		}
+		noBody := func(body *stateBodyWriter) {}
+
+		_, err := ReadState(versionedState(&StateHeader{FormatVersion: 2}, 1<<31, noBody))
+		assert.Error(t, err, "header length beyond the maximum")
+
+		_, err = ReadState(versionedState(&StateHeader{FormatVersion: 2, BucketCount: 1 << 60}, 0, noBody))
+		assert.Error(t, err, "bucket count beyond the buckets in the file")
+
+		_, err = ReadState(versionedState(&StateHeader{FormatVersion: 2, BucketCount: 1}, 0, func(body *stateBodyWriter) {
+			body.writeBytes([]byte("0/0/0"))
+			body.writeUvarint(1 << 60)
+		}))
+		assert.Error(t, err, "cell count beyond the cells in the file")
+
+		_, err = ReadState(versionedState(&StateHeader{FormatVersion: 2, BucketCount: 1}, 0, func(body *stateBodyWriter) {
+			body.writeUvarint(1 << 62)
+		}))
+		assert.Error(t, err, "record length beyond the maximum")
+
+		_, err = ReadState(versionedState(&StateHeader{FormatVersion: 1, CellCount: 1 << 60}, 0, noBody))
+		assert.Error(t, err, "cell count of a version 1 file beyond the cells in the file")
+	})
+
+	t.Run("version 1 files without buckets are still loaded", func(t *testing.T) {
+		s := testState()
+		header, err := json.Marshal(&StateHeader{FormatVersion: 1, TimeStep: 42, BucketWidth: 500, CellCount: 2})
+		require.NoError(t, err)
+		buffer := bytes.NewBufferString(stateFileMagic)
+		require.NoError(t, binary.Write(buffer, binary.BigEndian, []uint32{1, uint32(len(header))}))
+		buffer.Write(header)
+		body := &stateBodyWriter{writer: buffer}
+		for _, cell := range s.CellBuckets.AllCells() {
+			body.writeCell(cell)
+		}
+		require.NoError(t, body.err)
+
+		loaded, err := ReadState(buffer)
+		require.NoError(t, err)
+		assert.Equal(t, uint64(42), loaded.TimeStep)
+		assertSameBuckets(t, s.CellBuckets, loaded.CellBuckets)
+	})
+
+	t.Run("header can be read without the cells", func(t *testing.T) {
+		defer cleanup()
+		require.NoError(t, os.MkdirAll(testStatesFolderName, 0755))
+		path := filepath.Join(testStatesFolderName, "STATE_20190301120000")
+		require.NoError(t, writeStateFile(path, testState(), createdAt))
+
+		header, err := ReadStateHeader(path)
+		require.NoError(t, err)
+		assert.Equal(t, &StateHeader{
+			FormatVersion: StateFormatVersion,
+			TimeStep:      42,
+			BucketWidth:   500,
+			BigBangConfig: &BigBangConfig{CellAmount: 2, EnergyLevel: 3},
+			CellCount:     2,
+			BucketCount:   2,
+			CreatedAt:     createdAt,
+		}, header)
+	})
+
+	t.Run("legacy gob files are loaded and migrated", func(t *testing.T) {
+		defer cleanup()
+		require.NoError(t, os.MkdirAll(testStatesFolderName, 0755))
+		path := filepath.Join(testStatesFolderName, "STATE_20190301120000")
+		s := testState()
+		writeLegacyState(t, path, s)
+
+		legacy, err := LoadSimulationState(path)
+		require.NoError(t, err)
+		assertSameBuckets(t, s.CellBuckets, legacy.CellBuckets)
+		assert.Equal(t, uint64(42), legacy.TimeStep)
+
+		migrated, err := MigrateStateFile(path, 500)
+		require.NoError(t, err)
+		assert.True(t, migrated)
+		migrated, err = MigrateStateFile(path, 500)
+		require.NoError(t, err)
+		assert.False(t, migrated, "versioned files are left as they are")
+
+		header, err := ReadStateHeader(path)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(StateFormatVersion), header.FormatVersion)
+		assert.Equal(t, 500, header.BucketWidth)
+
+		loaded, err := LoadSimulationState(path)
+		require.NoError(t, err)
+		assertSameBuckets(t, s.CellBuckets, loaded.CellBuckets)
+	})
+
+	t.Run("loaded states are rebucketed to a different width", func(t *testing.T) {
+		s := testState()
+		s.Rebucket(1000)
+		assert.Equal(t, 1000, s.CellBucketWidth)
+		for key, cells := range s.CellBuckets {
+			for _, cell := range cells {
+				assert.Equal(t, key, bucketKeyFor(cell.Pos, 1000))
+			}
+		}
+	})
+}
+
+func BenchmarkStateFile(b *testing.B) {
+	for _, cellCount := range []int{100000, 1000000} {
+		cells := make([]*proto.Cell, cellCount)
+		for i := range cells {
+			cells[i] = &proto.Cell{
+				Id:          fmt.Sprint(i),
+				EnergyLevel: uint64(i % 100),
+				Dna:         []byte("ACGTACGTACGTACGT"),
+				Pos:         &proto.Vector{X: float32(i % 1000 * 10), Y: float32(i / 1000 % 1000 * 10), Z: float32(i / 1000000 * 10)},
+			}
+		}
+		s := NewSimulationState(CreateBuckets(cells, 500))
+		s.CellBucketWidth = 500
+
+		path := filepath.Join(os.TempDir(), fmt.Sprintf("al-master-benchmark-%v.state", cellCount))
+		defer os.Remove(path)
+
+		b.Run(fmt.Sprintf("save %v cells", cellCount), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := writeStateFile(path, s, time.Now()); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("load %v cells", cellCount), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := LoadSimulationState(path); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
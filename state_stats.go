@@ -0,0 +1,150 @@
+package master
+
+import (
+	"math"
+	"sort"
+
+	"github.com/codeuniversity/al-proto"
+	protobuf "github.com/golang/protobuf/proto"
+)
+
+//HistogramBin counts the values in [From, To)
+type HistogramBin struct {
+	From  uint64 `json:"from"`
+	To    uint64 `json:"to"`
+	Count int    `json:"count"`
+}
+
+//BoundingBox is the smallest axis aligned box containing all cells
+type BoundingBox struct {
+	Min Vector `json:"min"`
+	Max Vector `json:"max"`
+}
+
+//CellStatistics summarizes the cells of Buckets
+type CellStatistics struct {
+	CellCount    int            `json:"cell_count"`
+	BucketCount  int            `json:"bucket_count"`
+	EnergyLevels []HistogramBin `json:"energy_levels"`
+	DnaLengths   []HistogramBin `json:"dna_lengths"`
+	//BoundingBox is nil if there are no cells
+	BoundingBox *BoundingBox `json:"bounding_box,omitempty"`
+}
+
+//Statistics of the cells with histograms of at most binCount bins
+func (b Buckets) Statistics(binCount int) *CellStatistics {
+	stats := &CellStatistics{BucketCount: len(b)}
+	energyLevels := []uint64{}
+	dnaLengths := []uint64{}
+	for _, cells := range b {
+		for _, cell := range cells {
+			stats.CellCount++
+			energyLevels = append(energyLevels, cell.EnergyLevel)
+			dnaLengths = append(dnaLengths, uint64(len(cell.Dna)))
+			stats.BoundingBox = stats.BoundingBox.extend(cell.Pos)
+		}
+	}
+	stats.EnergyLevels = histogram(energyLevels, binCount)
+	stats.DnaLengths = histogram(dnaLengths, binCount)
+	return stats
+}
+
+//StateDiff lists how the cells changed from one state to another
+type StateDiff struct {
+	FromTimeStep uint64 `json:"from_time_step"`
+	ToTimeStep   uint64 `json:"to_time_step"`
+	//Added and Removed are the sorted ids of the cells only found in one of the states
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	//Moved, EnergyChanged and DnaChanged count the cells found in both states
+	Moved         int `json:"moved"`
+	EnergyChanged int `json:"energy_changed"`
+	DnaChanged    int `json:"dna_changed"`
+}
+
+//DiffStates from to to, matching cells by their id
+func DiffStates(from, to *SimulationState) *StateDiff {
+	diff := &StateDiff{
+		FromTimeStep: from.TimeStep,
+		ToTimeStep:   to.TimeStep,
+		Added:        []string{},
+		Removed:      []string{},
+	}
+	fromCells := map[string]*proto.Cell{}
+	for _, cells := range from.CellBuckets {
+		for _, cell := range cells {
+			fromCells[cell.Id] = cell
+		}
+	}
+
+	for _, cells := range to.CellBuckets {
+		for _, cell := range cells {
+			fromCell, ok := fromCells[cell.Id]
+			if !ok {
+				diff.Added = append(diff.Added, cell.Id)
+				continue
+			}
+			delete(fromCells, cell.Id)
+			if !protobuf.Equal(fromCell.Pos, cell.Pos) {
+				diff.Moved++
+			}
+			if fromCell.EnergyLevel != cell.EnergyLevel {
+				diff.EnergyChanged++
+			}
+			if string(fromCell.Dna) != string(cell.Dna) {
+				diff.DnaChanged++
+			}
+		}
+	}
+	for id := range fromCells {
+		diff.Removed = append(diff.Removed, id)
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	return diff
+}
+
+//extend the box by pos, creating it if the box is nil
+func (b *BoundingBox) extend(pos *proto.Vector) *BoundingBox {
+	if pos == nil {
+		return b
+	}
+	if b == nil {
+		corner := Vector{X: pos.X, Y: pos.Y, Z: pos.Z}
+		return &BoundingBox{Min: corner, Max: corner}
+	}
+	b.Min.X = float32(math.Min(float64(b.Min.X), float64(pos.X)))
+	b.Min.Y = float32(math.Min(float64(b.Min.Y), float64(pos.Y)))
+	b.Min.Z = float32(math.Min(float64(b.Min.Z), float64(pos.Z)))
+	b.Max.X = float32(math.Max(float64(b.Max.X), float64(pos.X)))
+	b.Max.Y = float32(math.Max(float64(b.Max.Y), float64(pos.Y)))
+	b.Max.Z = float32(math.Max(float64(b.Max.Z), float64(pos.Z)))
+	return b
+}
+
+//histogram of values with at most binCount bins of equal width covering all values
+func histogram(values []uint64, binCount int) []HistogramBin {
+	if len(values) == 0 || binCount <= 0 {
+		return []HistogramBin{}
+	}
+	min, max := values[0], values[0]
+	for _, value := range values {
+		if value < min {
+			min = value
+		}
+		if value > max {
+			max = value
+		}
+	}
+	width := (max-min)/uint64(binCount) + 1
+
+	bins := []HistogramBin{}
+	for i := 0; i < binCount && min+uint64(i)*width <= max; i++ {
+		from := min + uint64(i)*width
+		bins = append(bins, HistogramBin{From: from, To: from + width})
+	}
+	for _, value := range values {
+		bins[(value-min)/width].Count++
+	}
+	return bins
+}
@@ -0,0 +1,60 @@
+package master
+
+import (
+	"testing"
+
+	"github.com/codeuniversity/al-proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBucketsStatistics(t *testing.T) {
+	t.Run("histograms and bounding box", func(t *testing.T) {
+		cells := []*proto.Cell{
+			{Id: "a", EnergyLevel: 0, Dna: []byte("AC"), Pos: &proto.Vector{X: -10, Y: 5, Z: 0}},
+			{Id: "b", EnergyLevel: 5, Dna: []byte("ACGT"), Pos: &proto.Vector{X: 700, Y: -20, Z: 3}},
+			{Id: "c", EnergyLevel: 9, Dna: []byte("ACGT"), Pos: &proto.Vector{X: 0, Y: 0, Z: 1200}},
+		}
+		stats := CreateBuckets(cells, 500).Statistics(2)
+
+		assert.Equal(t, 3, stats.CellCount)
+		assert.Equal(t, 3, stats.BucketCount)
+		assert.Equal(t, []HistogramBin{{From: 0, To: 5, Count: 1}, {From: 5, To: 10, Count: 2}}, stats.EnergyLevels)
+		assert.Equal(t, []HistogramBin{{From: 2, To: 4, Count: 1}, {From: 4, To: 6, Count: 2}}, stats.DnaLengths)
+		assert.Equal(t, &BoundingBox{Min: Vector{X: -10, Y: -20, Z: 0}, Max: Vector{X: 700, Y: 5, Z: 1200}}, stats.BoundingBox)
+	})
+
+	t.Run("without cells", func(t *testing.T) {
+		stats := Buckets{}.Statistics(10)
+		assert.Equal(t, 0, stats.CellCount)
+		assert.Empty(t, stats.EnergyLevels)
+		assert.Nil(t, stats.BoundingBox)
+	})
+
+	t.Run("equal values share one bin", func(t *testing.T) {
+		assert.Equal(t, []HistogramBin{{From: 4, To: 5, Count: 3}}, histogram([]uint64{4, 4, 4}, 10))
+	})
+}
+
+func TestDiffStates(t *testing.T) {
+	from := NewSimulationState(CreateBuckets([]*proto.Cell{
+		{Id: "stays", EnergyLevel: 3, Pos: &proto.Vector{X: 1}},
+		{Id: "moves", EnergyLevel: 3, Pos: &proto.Vector{X: 1}},
+		{Id: "dies", EnergyLevel: 3, Pos: &proto.Vector{X: 1}},
+	}, 500))
+	to := NewSimulationState(CreateBuckets([]*proto.Cell{
+		{Id: "stays", EnergyLevel: 3, Pos: &proto.Vector{X: 1}},
+		{Id: "moves", EnergyLevel: 2, Pos: &proto.Vector{X: 2}},
+		{Id: "born", EnergyLevel: 3, Pos: &proto.Vector{X: 1}},
+	}, 500))
+	from.TimeStep = 4
+	to.TimeStep = 7
+
+	assert.Equal(t, &StateDiff{
+		FromTimeStep:  4,
+		ToTimeStep:    7,
+		Added:         []string{"born"},
+		Removed:       []string{"dies"},
+		Moved:         1,
+		EnergyChanged: 1,
+	}, DiffStates(from, to))
+}
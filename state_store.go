@@ -0,0 +1,126 @@
+package master
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/codeuniversity/al-master/logging"
+)
+
+//stateLogger logs saving and loading states
+var stateLogger = logging.For("state")
+
+//StateStore persists saved states under their names, see StateName
+type StateStore interface {
+	Save(name string, s *SimulationState) error
+	Load(name string) (*SimulationState, error)
+	//List the names of all states, oldest first
+	List() ([]string, error)
+	//Latest state name, an error if there is none
+	Latest() (string, error)
+	Delete(name string) error
+	//SaveReport about the state with the given name, stored next to it as <name>.report.json
+	SaveReport(stateName string, report []byte) error
+}
+
+func reportName(stateName string) string {
+	return stateName + ".report.json"
+}
+
+//StateName for a state saved at saveTime. The nanoseconds keep the names of states saved within the same second apart
+func StateName(saveTime time.Time) string {
+	return "STATE_" + saveTime.Format("20060102150405") + fmt.Sprintf("_%09d", saveTime.Nanosecond())
+}
+
+//FileStateStore keeps the states as files in a folder
+type FileStateStore struct {
+	Folder string
+}
+
+//NewFileStateStore in folder, which is created with the first Save
+func NewFileStateStore(folder string) *FileStateStore {
+	return &FileStateStore{Folder: folder}
+}
+
+//Save the state to a temporary file first, so a crash never leaves a partially written state behind
+func (f *FileStateStore) Save(name string, s *SimulationState) error {
+	if err := os.MkdirAll(f.Folder, 0755); err != nil {
+		return err
+	}
+	temporaryPath := filepath.Join(f.Folder, "SAVING_"+name)
+	if err := writeStateFile(temporaryPath, s, time.Now()); err != nil {
+		return err
+	}
+	return os.Rename(temporaryPath, f.path(name))
+}
+
+//Load the state with the given name
+func (f *FileStateStore) Load(name string) (*SimulationState, error) {
+	return LoadSimulationState(f.path(name))
+}
+
+//List the names of all states in the folder, oldest first
+func (f *FileStateStore) List() ([]string, error) {
+	files, err := ioutil.ReadDir(f.Folder)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	return sortStateNames(names), nil
+}
+
+//Latest state name in the folder
+func (f *FileStateStore) Latest() (string, error) {
+	files, err := ioutil.ReadDir(f.Folder)
+	if err != nil {
+		return "", err
+	}
+	name := nameOfLatestState(files)
+	if name == "" {
+		return "", fmt.Errorf("there are no states in %v", f.Folder)
+	}
+	return name, nil
+}
+
+//Delete the state with the given name and its report
+func (f *FileStateStore) Delete(name string) error {
+	if err := os.Remove(f.path(reportName(name))); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Remove(f.path(name))
+}
+
+//SaveReport next to the state with the given name
+func (f *FileStateStore) SaveReport(stateName string, report []byte) error {
+	return ioutil.WriteFile(f.path(reportName(stateName)), report, 0644)
+}
+
+func (f *FileStateStore) path(name string) string {
+	return filepath.Join(f.Folder, name)
+}
+
+//LoadLatestState of store
+func LoadLatestState(store StateStore) (*SimulationState, error) {
+	name, err := store.Latest()
+	if err != nil {
+		return nil, err
+	}
+	stateLogger.With("state", name).Debug("loading latest state")
+	return store.Load(name)
+}
+
+//stateLoaded logs the state the simulation continues from
+func stateLoaded(source string, s *SimulationState) {
+	stateLogger.
+		With("source", source).
+		With("time_step", s.TimeStep).
+		With("cell_count", len(s.CellBuckets.AllCells())).
+		With("bucket_count", len(s.CellBuckets)).
+		Info("state loaded")
+}
@@ -0,0 +1,107 @@
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/codeuniversity/al-master/filters"
+)
+
+//StopConditions end Run with a final snapshot and a summary report. Zero values disable a condition
+type StopConditions struct {
+	//MaxTimeStep stops once the simulation reached this time step
+	MaxTimeStep uint64 `json:"max_time_step,omitempty"`
+	//MaxWallClock stops once Run took this long
+	MaxWallClock time.Duration `json:"max_wall_clock,omitempty"`
+	//MinCells stops once fewer cells are alive
+	MinCells int `json:"min_cells,omitempty"`
+	//MaxCells stops once more cells are alive
+	MaxCells int `json:"max_cells,omitempty"`
+	//NoCellMatches stops once no cell passes all of these filters
+	NoCellMatches []*filters.FilterDefinition `json:"no_cell_matches,omitempty"`
+}
+
+//RunSummary is saved next to the final state once a stop condition is met
+type RunSummary struct {
+	Reason         string         `json:"reason"`
+	State          string         `json:"state"`
+	StartedAt      time.Time      `json:"started_at"`
+	FinishedAt     time.Time      `json:"finished_at"`
+	WallClock      time.Duration  `json:"wall_clock"`
+	StartTimeStep  uint64         `json:"start_time_step"`
+	TimeStep       uint64         `json:"time_step"`
+	StartCellCount int            `json:"start_cell_count"`
+	CellCount      int            `json:"cell_count"`
+	FailedSteps    int            `json:"failed_steps"`
+	StopConditions StopConditions `json:"stop_conditions"`
+}
+
+//stopReason describes the first stop condition that is met, "" if the simulation goes on
+func (s *Server) stopReason(now time.Time) string {
+	conditions := s.StopConditions
+	if conditions.MaxTimeStep > 0 && s.TimeStep >= conditions.MaxTimeStep {
+		return fmt.Sprintf("reached time step %v", conditions.MaxTimeStep)
+	}
+	if conditions.MaxWallClock > 0 && now.Sub(s.summary.StartedAt) >= conditions.MaxWallClock {
+		return fmt.Sprintf("ran for %v", conditions.MaxWallClock)
+	}
+
+	if conditions.MinCells == 0 && conditions.MaxCells == 0 && s.noCellMatchesFilter == nil {
+		return ""
+	}
+	cells := s.CellBuckets.AllCells()
+	if len(cells) < conditions.MinCells {
+		return fmt.Sprintf("%v cells are fewer than %v", len(cells), conditions.MinCells)
+	}
+	if conditions.MaxCells > 0 && len(cells) > conditions.MaxCells {
+		return fmt.Sprintf("%v cells are more than %v", len(cells), conditions.MaxCells)
+	}
+	if s.noCellMatchesFilter != nil {
+		for _, cell := range cells {
+			if passes, _ := s.noCellMatchesFilter.Eval(cell); passes {
+				return ""
+			}
+		}
+		return "no cell matches the filter"
+	}
+	return ""
+}
+
+//startSummary when Run starts
+func (s *Server) startSummary(now time.Time) {
+	s.summary = &RunSummary{
+		StartedAt:      now,
+		StartTimeStep:  s.TimeStep,
+		StartCellCount: len(s.CellBuckets.AllCells()),
+		StopConditions: s.StopConditions,
+	}
+}
+
+//finish the run because of reason, saving a final state and the summary next to it
+func (s *Server) finish(reason string) {
+	serverLogger.With("reason", reason).With("time_step", s.TimeStep).Info("stopping")
+	s.closeConnections()
+
+	stateName, err := s.checkpoint()
+	if err != nil {
+		stateLogger.WithError(err).With("time_step", s.TimeStep).Error("final state could not be saved")
+	}
+
+	finishedAt := time.Now()
+	s.summary.Reason = reason
+	s.summary.State = stateName
+	s.summary.FinishedAt = finishedAt
+	s.summary.WallClock = finishedAt.Sub(s.summary.StartedAt)
+	s.summary.TimeStep = s.TimeStep
+	s.summary.CellCount = len(s.CellBuckets.AllCells())
+	report, err := json.MarshalIndent(s.summary, "", "  ")
+	if err == nil && stateName != "" {
+		err = s.StateStore.SaveReport(stateName, report)
+	}
+	if err != nil {
+		stateLogger.WithError(err).With("state", stateName).Error("summary could not be saved")
+		return
+	}
+	stateLogger.With("state", stateName).With("time_step", s.TimeStep).Info("state and its summary successfully saved")
+}
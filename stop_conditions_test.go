@@ -0,0 +1,95 @@
+package master
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/codeuniversity/al-master/filters"
+	"github.com/codeuniversity/al-proto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStopReason(t *testing.T) {
+	now := time.Now()
+	newServer := func(conditions StopConditions) *Server {
+		s := NewServer(ServerConfig{StopConditions: conditions})
+		s.SimulationState = NewSimulationState(CreateBuckets([]*proto.Cell{
+			{Id: "a", Pos: &proto.Vector{X: 10}},
+			{Id: "b", Pos: &proto.Vector{X: 20}},
+		}, 500))
+		s.startSummary(now)
+		return s
+	}
+
+	t.Run("no conditions", func(t *testing.T) {
+		s := newServer(StopConditions{})
+		s.TimeStep = 1000
+		assert.Equal(t, "", s.stopReason(now.Add(time.Hour)))
+	})
+	t.Run("max time step", func(t *testing.T) {
+		s := newServer(StopConditions{MaxTimeStep: 10})
+		s.TimeStep = 9
+		assert.Equal(t, "", s.stopReason(now))
+		s.TimeStep = 10
+		assert.Equal(t, "reached time step 10", s.stopReason(now))
+	})
+	t.Run("wall clock", func(t *testing.T) {
+		s := newServer(StopConditions{MaxWallClock: time.Minute})
+		assert.Equal(t, "", s.stopReason(now.Add(59*time.Second)))
+		assert.Equal(t, "ran for 1m0s", s.stopReason(now.Add(time.Minute)))
+	})
+	t.Run("cell count", func(t *testing.T) {
+		assert.Equal(t, "", newServer(StopConditions{MinCells: 2, MaxCells: 2}).stopReason(now))
+		assert.Equal(t, "2 cells are fewer than 3", newServer(StopConditions{MinCells: 3}).stopReason(now))
+		assert.Equal(t, "2 cells are more than 1", newServer(StopConditions{MaxCells: 1}).stopReason(now))
+	})
+	t.Run("no cell matches a filter", func(t *testing.T) {
+		filter := func(x string) []*filters.FilterDefinition {
+			return []*filters.FilterDefinition{{LeftHand: "cell.pos.x", LeftHandType: "coordinate", Operator: ">", RightHand: x, RightHandType: "number"}}
+		}
+		assert.Equal(t, "", newServer(StopConditions{NoCellMatches: filter("15")}).stopReason(now))
+		assert.Equal(t, "no cell matches the filter", newServer(StopConditions{NoCellMatches: filter("20")}).stopReason(now))
+	})
+}
+
+func TestRunStopsAtStopCondition(t *testing.T) {
+	defer cleanup()
+	slave := startFakeSlave(t, 0)
+	defer slave.grpcServer.Stop()
+
+	config := testServerConfig()
+	config.StatesDir = testStatesFolderName
+	config.StopConditions.MaxTimeStep = 5
+	s := startTestServer(t, config, slave)
+
+	runDone := make(chan struct{})
+	go func() {
+		s.Run()
+		close(runDone)
+	}()
+	select {
+	case <-runDone:
+	case <-time.After(stepDeadlockTimeout):
+		t.Fatal("Run didn't stop")
+	}
+
+	stateName, err := s.StateStore.Latest()
+	require.NoError(t, err)
+	state, err := s.StateStore.Load(stateName)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), state.TimeStep)
+
+	report, err := ioutil.ReadFile(filepath.Join(testStatesFolderName, reportName(stateName)))
+	require.NoError(t, err)
+	summary := &RunSummary{}
+	require.NoError(t, json.Unmarshal(report, summary))
+	assert.Equal(t, "reached time step 5", summary.Reason)
+	assert.Equal(t, stateName, summary.State)
+	assert.Equal(t, uint64(0), summary.StartTimeStep)
+	assert.Equal(t, uint64(5), summary.TimeStep)
+	assert.Equal(t, 2000, summary.CellCount)
+}
@@ -0,0 +1,276 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/codeuniversity/al-master/logging"
+)
+
+var tracingLogger = logging.For("tracing")
+
+//spanRecord is how a span is written by the FileExporter
+type spanRecord struct {
+	TraceID         string                 `json:"trace_id"`
+	SpanID          string                 `json:"span_id"`
+	ParentSpanID    string                 `json:"parent_span_id,omitempty"`
+	Name            string                 `json:"name"`
+	Start           time.Time              `json:"start"`
+	End             time.Time              `json:"end"`
+	DurationSeconds float64                `json:"duration_seconds"`
+	Attributes      map[string]interface{} `json:"attributes,omitempty"`
+	Error           string                 `json:"error,omitempty"`
+}
+
+func newSpanRecord(span *Span) *spanRecord {
+	record := &spanRecord{
+		TraceID:         span.TraceID.String(),
+		SpanID:          span.SpanID.String(),
+		Name:            span.Name,
+		Start:           span.Start,
+		End:             span.End,
+		DurationSeconds: span.End.Sub(span.Start).Seconds(),
+		Attributes:      span.Attributes,
+		Error:           span.Error,
+	}
+	if span.ParentSpanID.IsValid() {
+		record.ParentSpanID = span.ParentSpanID.String()
+	}
+	return record
+}
+
+//FileExporter appends every span as JSON line to a file
+type FileExporter struct {
+	file    *os.File
+	encoder *json.Encoder
+	lock    *sync.Mutex
+}
+
+//NewFileExporter appending to the file at path
+func NewFileExporter(path string) (*FileExporter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileExporter{file: file, encoder: json.NewEncoder(file), lock: &sync.Mutex{}}, nil
+}
+
+//ExportSpan writes the span to the file
+func (e *FileExporter) ExportSpan(span *Span) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if err := e.encoder.Encode(newSpanRecord(span)); err != nil {
+		tracingLogger.WithError(err).With("span", span.Name).Warn("couldn't write span")
+	}
+}
+
+//Close the file
+func (e *FileExporter) Close() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.file.Close()
+}
+
+//otlpMaxBatchSize is the amount of buffered spans that triggers an export before the flush interval passed
+const otlpMaxBatchSize = 512
+
+//OTLPExporter posts the spans in batches as OTLP/JSON to the traces endpoint of a collector,
+//e.g. http://localhost:4318/v1/traces
+type OTLPExporter struct {
+	endpoint    string
+	serviceName string
+	client      *http.Client
+
+	lock  *sync.Mutex
+	spans []*Span
+
+	flushRequests chan struct{}
+	closing       chan struct{}
+	closed        chan error
+}
+
+//NewOTLPExporter that exports the buffered spans every flushInterval
+func NewOTLPExporter(endpoint, serviceName string, flushInterval time.Duration) *OTLPExporter {
+	e := &OTLPExporter{
+		endpoint:      endpoint,
+		serviceName:   serviceName,
+		client:        &http.Client{Timeout: 10 * time.Second},
+		lock:          &sync.Mutex{},
+		flushRequests: make(chan struct{}, 1),
+		closing:       make(chan struct{}),
+		closed:        make(chan error),
+	}
+	go e.run(flushInterval)
+	return e
+}
+
+//ExportSpan buffers the span until the next flush
+func (e *OTLPExporter) ExportSpan(span *Span) {
+	e.lock.Lock()
+	e.spans = append(e.spans, span)
+	full := len(e.spans) >= otlpMaxBatchSize
+	e.lock.Unlock()
+	if full {
+		select {
+		case e.flushRequests <- struct{}{}:
+		default:
+		}
+	}
+}
+
+//Close exports the remaining spans and stops flushing
+func (e *OTLPExporter) Close() error {
+	close(e.closing)
+	return <-e.closed
+}
+
+func (e *OTLPExporter) run(flushInterval time.Duration) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-e.flushRequests:
+		case <-e.closing:
+			e.closed <- e.flush()
+			return
+		}
+		if err := e.flush(); err != nil {
+			tracingLogger.WithError(err).With("endpoint", e.endpoint).Warn("couldn't export spans")
+		}
+	}
+}
+
+func (e *OTLPExporter) flush() error {
+	e.lock.Lock()
+	spans := e.spans
+	e.spans = nil
+	e.lock.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	response, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("collector answered with %v", response.Status)
+	}
+	return nil
+}
+
+type otlpRequest struct {
+	ResourceSpans []*otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource      `json:"resource"`
+	ScopeSpans []*otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []*otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope   `json:"scope"`
+	Spans []*otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string           `json:"traceId"`
+	SpanID            string           `json:"spanId"`
+	ParentSpanID      string           `json:"parentSpanId,omitempty"`
+	Name              string           `json:"name"`
+	Kind              int              `json:"kind"`
+	StartTimeUnixNano string           `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string           `json:"endTimeUnixNano"`
+	Attributes        []*otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus       `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+	otlpStatusCodeError  = 2
+)
+
+func (e *OTLPExporter) request(spans []*Span) *otlpRequest {
+	scopeSpans := &otlpScopeSpans{Scope: otlpScope{Name: "github.com/codeuniversity/al-master/tracing"}}
+	for _, span := range spans {
+		converted := &otlpSpan{
+			TraceID:           span.TraceID.String(),
+			SpanID:            span.SpanID.String(),
+			Name:              span.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+		}
+		if span.ParentSpanID.IsValid() {
+			converted.ParentSpanID = span.ParentSpanID.String()
+		}
+		for key, value := range span.Attributes {
+			converted.Attributes = append(converted.Attributes, newOTLPAttribute(key, value))
+		}
+		if span.Error != "" {
+			converted.Status = otlpStatus{Code: otlpStatusCodeError, Message: span.Error}
+		}
+		scopeSpans.Spans = append(scopeSpans.Spans, converted)
+	}
+
+	return &otlpRequest{ResourceSpans: []*otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []*otlpAttribute{
+			newOTLPAttribute("service.name", e.serviceName),
+		}},
+		ScopeSpans: []*otlpScopeSpans{scopeSpans},
+	}}}
+}
+
+//newOTLPAttribute with the value typed as OTLP/JSON expects it, 64 bit integers are encoded as strings
+func newOTLPAttribute(key string, value interface{}) *otlpAttribute {
+	var typed map[string]interface{}
+	switch v := value.(type) {
+	case string:
+		typed = map[string]interface{}{"stringValue": v}
+	case bool:
+		typed = map[string]interface{}{"boolValue": v}
+	case int:
+		typed = map[string]interface{}{"intValue": strconv.FormatInt(int64(v), 10)}
+	case int64:
+		typed = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+	case uint64:
+		typed = map[string]interface{}{"intValue": strconv.FormatUint(v, 10)}
+	case float32:
+		typed = map[string]interface{}{"doubleValue": float64(v)}
+	case float64:
+		typed = map[string]interface{}{"doubleValue": v}
+	default:
+		typed = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+	}
+	return &otlpAttribute{Key: key, Value: typed}
+}
@@ -0,0 +1,93 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileExporter(t *testing.T) {
+	folder, err := ioutil.TempDir("", "tracing")
+	require.NoError(t, err)
+	defer os.RemoveAll(folder)
+	path := filepath.Join(folder, "spans.jsonl")
+
+	exporter, err := NewFileExporter(path)
+	require.NoError(t, err)
+	tracer := NewTracer(exporter)
+	ctx, root := tracer.Start(context.Background(), "step")
+	_, child := tracer.Start(ctx, "callCIS")
+	child.SetAttribute("bucket_key", "1/2/3")
+	child.Finish()
+	root.Finish()
+	require.NoError(t, tracer.Close())
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	record := &spanRecord{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), record))
+	assert.Equal(t, "callCIS", record.Name)
+	assert.Equal(t, root.TraceID.String(), record.TraceID)
+	assert.Equal(t, root.SpanID.String(), record.ParentSpanID)
+	assert.Equal(t, "1/2/3", record.Attributes["bucket_key"])
+}
+
+func TestOTLPExporter(t *testing.T) {
+	lock := &sync.Mutex{}
+	requests := []*otlpRequest{}
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		request := &otlpRequest{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(request))
+		lock.Lock()
+		requests = append(requests, request)
+		lock.Unlock()
+	}))
+	defer collector.Close()
+
+	exporter := NewOTLPExporter(collector.URL+"/v1/traces", "al-master", time.Hour)
+	tracer := NewTracer(exporter)
+	ctx, root := tracer.Start(context.Background(), "step")
+	_, child := tracer.Start(ctx, "computeBatch")
+	child.SetAttribute("attempt", 3)
+	child.SetAttribute("slave_address", "127.0.0.1:5000")
+	child.SetError(errors.New("unavailable"))
+	child.Finish()
+	root.Finish()
+	require.NoError(t, tracer.Close())
+
+	require.Len(t, requests, 1, "the remaining spans are exported on close")
+	resourceSpans := requests[0].ResourceSpans[0]
+	assert.Equal(t, "service.name", resourceSpans.Resource.Attributes[0].Key)
+	assert.Equal(t, "al-master", resourceSpans.Resource.Attributes[0].Value["stringValue"])
+	spans := resourceSpans.ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+
+	exported := spans[0]
+	assert.Equal(t, "computeBatch", exported.Name)
+	assert.Equal(t, root.TraceID.String(), exported.TraceID)
+	assert.Equal(t, root.SpanID.String(), exported.ParentSpanID)
+	assert.Equal(t, otlpStatus{Code: otlpStatusCodeError, Message: "unavailable"}, exported.Status)
+	attributes := map[string]map[string]interface{}{}
+	for _, attribute := range exported.Attributes {
+		attributes[attribute.Key] = attribute.Value
+	}
+	assert.Equal(t, map[string]interface{}{"intValue": "3"}, attributes["attempt"])
+	assert.Equal(t, map[string]interface{}{"stringValue": "127.0.0.1:5000"}, attributes["slave_address"])
+	assert.Empty(t, spans[1].ParentSpanID)
+}
@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/metadata"
+)
+
+//TraceparentHeader is the W3C trace context header, also used as grpc metadata key
+const TraceparentHeader = "traceparent"
+
+//Traceparent formats the span context as W3C traceparent value, always flagged as sampled
+func Traceparent(spanContext SpanContext) string {
+	return fmt.Sprintf("00-%v-%v-01", spanContext.TraceID, spanContext.SpanID)
+}
+
+//ParseTraceparent value of the W3C trace context header
+func ParseTraceparent(value string) (SpanContext, error) {
+	spanContext := SpanContext{}
+	parts := strings.Split(value, "-")
+	if len(parts) != 4 || parts[0] != "00" {
+		return spanContext, fmt.Errorf("traceparent %q isn't of the form 00-<trace id>-<span id>-<flags>", value)
+	}
+	if err := decodeID(spanContext.TraceID[:], parts[1]); err != nil {
+		return spanContext, err
+	}
+	if err := decodeID(spanContext.SpanID[:], parts[2]); err != nil {
+		return spanContext, err
+	}
+	if !spanContext.IsValid() {
+		return spanContext, errors.New("traceparent ids must not be all zeros")
+	}
+	return spanContext, nil
+}
+
+func decodeID(id []byte, value string) error {
+	if len(value) != 2*len(id) {
+		return fmt.Errorf("traceparent id %q should have %v hex digits", value, 2*len(id))
+	}
+	_, err := hex.Decode(id, []byte(value))
+	return err
+}
+
+//Inject the span context of ctx as traceparent into the outgoing grpc metadata
+func Inject(ctx context.Context) context.Context {
+	spanContext := SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, TraceparentHeader, Traceparent(spanContext))
+}
+
+//Extract the traceparent of the incoming grpc metadata, so spans started with the returned context continue the remote trace
+func Extract(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	values := md.Get(TraceparentHeader)
+	if len(values) == 0 {
+		return ctx
+	}
+	spanContext, err := ParseTraceparent(values[0])
+	if err != nil {
+		return ctx
+	}
+	return ContextWithSpanContext(ctx, spanContext)
+}
@@ -0,0 +1,166 @@
+//Package tracing records spans of the work done for a time step, in the spirit of OpenTelemetry.
+//
+//A Tracer without Exporter hands out nil spans, so instrumented code doesn't need to check whether tracing is enabled:
+//all methods of a nil *Span do nothing.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+//TraceID identifies all spans of one trace
+type TraceID [16]byte
+
+//SpanID identifies a span within its trace
+type SpanID [8]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+//IsValid if the id is not all zeros
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+//IsValid if the id is not all zeros
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+//SpanContext is the part of a span that is propagated to child spans, also across processes
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+}
+
+//IsValid if both ids are set
+func (c SpanContext) IsValid() bool {
+	return c.TraceID.IsValid() && c.SpanID.IsValid()
+}
+
+//Span is a timed operation. It is handed to the Exporter once it ends
+type Span struct {
+	SpanContext
+	ParentSpanID SpanID
+	Name         string
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]interface{}
+	//Error is the message of the error the operation failed with, empty if it succeeded
+	Error string
+
+	tracer *Tracer
+	lock   *sync.Mutex
+	ended  bool
+}
+
+//SetAttribute of the span. Values should be strings, bools, integers or floats
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	s.Attributes[key] = value
+	s.lock.Unlock()
+}
+
+//SetError marks the span as failed if err isn't nil
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.lock.Lock()
+	s.Error = err.Error()
+	s.lock.Unlock()
+}
+
+//Finish the span and export it. Only the first call has an effect
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	if s.ended {
+		s.lock.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.lock.Unlock()
+	s.tracer.exporter.ExportSpan(s)
+}
+
+//Exporter sends finished spans somewhere. ExportSpan is called concurrently and must not block for long
+type Exporter interface {
+	ExportSpan(span *Span)
+	//Close exports the spans that are still buffered
+	Close() error
+}
+
+//Tracer starts spans and hands them to its Exporter
+type Tracer struct {
+	exporter Exporter
+}
+
+//NewTracer exporting to exporter. A nil exporter disables tracing
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+//Enabled if spans are recorded
+func (t *Tracer) Enabled() bool {
+	return t != nil && t.exporter != nil
+}
+
+//Start a span that is a child of the span in ctx, or of the remote span extracted into ctx.
+//The returned context carries the new span
+func (t *Tracer) Start(ctx context.Context, name string) (context.Context, *Span) {
+	if !t.Enabled() {
+		return ctx, nil
+	}
+	span := &Span{
+		Name:       name,
+		Start:      time.Now(),
+		Attributes: map[string]interface{}{},
+		tracer:     t,
+		lock:       &sync.Mutex{},
+	}
+	if parent := SpanContextFromContext(ctx); parent.IsValid() {
+		span.TraceID = parent.TraceID
+		span.ParentSpanID = parent.SpanID
+	} else {
+		rand.Read(span.TraceID[:])
+	}
+	rand.Read(span.SpanID[:])
+	return ContextWithSpanContext(ctx, span.SpanContext), span
+}
+
+//Close the exporter
+func (t *Tracer) Close() error {
+	if !t.Enabled() {
+		return nil
+	}
+	return t.exporter.Close()
+}
+
+type spanContextKey struct{}
+
+//ContextWithSpanContext returns a context whose spans become children of spanContext
+func ContextWithSpanContext(ctx context.Context, spanContext SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, spanContext)
+}
+
+//SpanContextFromContext returns the SpanContext of the current span, which is invalid if there is none
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	spanContext, _ := ctx.Value(spanContextKey{}).(SpanContext)
+	return spanContext
+}
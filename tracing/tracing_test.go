@@ -0,0 +1,108 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+)
+
+type recordingExporter struct {
+	lock  sync.Mutex
+	spans []*Span
+}
+
+func (e *recordingExporter) ExportSpan(span *Span) {
+	e.lock.Lock()
+	e.spans = append(e.spans, span)
+	e.lock.Unlock()
+}
+
+func (e *recordingExporter) Close() error {
+	return nil
+}
+
+func TestTracer(t *testing.T) {
+	t.Run("children share the trace of their parent", func(t *testing.T) {
+		exporter := &recordingExporter{}
+		tracer := NewTracer(exporter)
+
+		ctx, root := tracer.Start(context.Background(), "root")
+		_, child := tracer.Start(ctx, "child")
+		child.SetAttribute("attempt", 2)
+		child.SetError(errors.New("failed"))
+		child.Finish()
+		child.Finish()
+		root.Finish()
+
+		require.Len(t, exporter.spans, 2)
+		assert.Equal(t, "child", exporter.spans[0].Name)
+		assert.Equal(t, root.TraceID, child.TraceID)
+		assert.Equal(t, root.SpanID, child.ParentSpanID)
+		assert.NotEqual(t, root.SpanID, child.SpanID)
+		assert.False(t, root.ParentSpanID.IsValid())
+		assert.Equal(t, 2, child.Attributes["attempt"])
+		assert.Equal(t, "failed", child.Error)
+		assert.False(t, child.End.Before(child.Start))
+	})
+
+	t.Run("without exporter spans are nil and ignore all calls", func(t *testing.T) {
+		tracer := NewTracer(nil)
+		ctx, span := tracer.Start(context.Background(), "root")
+		assert.Nil(t, span)
+		assert.Equal(t, context.Background(), ctx)
+		span.SetAttribute("key", "value")
+		span.SetError(errors.New("failed"))
+		span.Finish()
+		assert.NoError(t, tracer.Close())
+	})
+}
+
+func TestPropagation(t *testing.T) {
+	t.Run("traceparent round trip", func(t *testing.T) {
+		spanContext := SpanContext{TraceID: TraceID{1, 2, 3}, SpanID: SpanID{4, 5, 6}}
+		value := Traceparent(spanContext)
+		assert.Equal(t, "00-01020300000000000000000000000000-0405060000000000-01", value)
+
+		parsed, err := ParseTraceparent(value)
+		require.NoError(t, err)
+		assert.Equal(t, spanContext, parsed)
+	})
+
+	t.Run("invalid traceparents are rejected", func(t *testing.T) {
+		for _, value := range []string{
+			"",
+			"01-01020300000000000000000000000000-0405060000000000-01",
+			"00-0102-0405060000000000-01",
+			"00-0102030000000000000000000000000g-0405060000000000-01",
+			"00-00000000000000000000000000000000-0000000000000000-01",
+		} {
+			_, err := ParseTraceparent(value)
+			assert.Error(t, err, value)
+		}
+	})
+
+	t.Run("spans continue the trace extracted from grpc metadata", func(t *testing.T) {
+		exporter := &recordingExporter{}
+		tracer := NewTracer(exporter)
+		ctx, span := tracer.Start(context.Background(), "client")
+
+		outgoing, ok := metadata.FromOutgoingContext(Inject(ctx))
+		require.True(t, ok)
+		incoming := metadata.NewIncomingContext(context.Background(), outgoing)
+		_, remote := tracer.Start(Extract(incoming), "server")
+
+		assert.Equal(t, span.TraceID, remote.TraceID)
+		assert.Equal(t, span.SpanID, remote.ParentSpanID)
+	})
+
+	t.Run("contexts without span are left alone", func(t *testing.T) {
+		ctx := context.Background()
+		assert.Equal(t, ctx, Inject(ctx))
+		assert.Equal(t, ctx, Extract(ctx))
+	})
+}
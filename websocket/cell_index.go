@@ -0,0 +1,40 @@
+package websocket
+
+import (
+	"sync"
+
+	"github.com/codeuniversity/al-master/filters"
+	"github.com/codeuniversity/al-proto"
+)
+
+//CellIndex gives access to the cells of a time step, so connections with a region filter don't need to look at all of them
+type CellIndex interface {
+	AllCells() []*proto.Cell
+	//CellsIn returns at least all cells within the region, it may return cells outside of it too
+	CellsIn(region filters.Region) []*proto.Cell
+}
+
+//cellSlice is a CellIndex without any spatial information
+type cellSlice []*proto.Cell
+
+func (s cellSlice) AllCells() []*proto.Cell {
+	return s
+}
+
+func (s cellSlice) CellsIn(filters.Region) []*proto.Cell {
+	return s
+}
+
+//sharedCellIndex collects all cells only once for all connections without a region filter
+type sharedCellIndex struct {
+	CellIndex
+	once     sync.Once
+	allCells []*proto.Cell
+}
+
+func (i *sharedCellIndex) AllCells() []*proto.Cell {
+	i.once.Do(func() {
+		i.allCells = i.CellIndex.AllCells()
+	})
+	return i.allCells
+}
@@ -1,19 +1,20 @@
 package websocket
 
 import (
-	"fmt"
 	"sync"
 
 	"github.com/codeuniversity/al-proto"
 
 	"github.com/codeuniversity/al-master/filters"
+	"github.com/codeuniversity/al-master/logging"
 	"github.com/gorilla/websocket"
 )
 
 //Connection is a wrapper around a websocket conn that includes handling for filtering
 type Connection struct {
-	Conn      *websocket.Conn
-	FilterSet filters.Set
+	Conn *websocket.Conn
+	//FilterSet decides which cells are sent, nothing is sent while it is nil
+	FilterSet filters.Evaluator
 
 	writeMutex           *sync.Mutex
 	filterSetMutex       *sync.Mutex
@@ -40,8 +41,19 @@ func (c *Connection) OnListenError(f func(error)) {
 	c.onListenErrorHandler = f
 }
 
+//logger with the remote address of the connection
+func (c *Connection) logger() *logging.Logger {
+	return websocketLogger.With("remote_address", c.Conn.RemoteAddr().String())
+}
+
 //WriteRequestedCells checks all given cells with the filterset that the client has sent.
 func (c *Connection) WriteRequestedCells(cells []*proto.Cell) error {
+	return c.WriteRequestedCellsFrom(cellSlice(cells))
+}
+
+//WriteRequestedCellsFrom the index, that pass the filterset that the client has sent.
+//If the filterset is limited to a region, only the cells the index returns for it are checked
+func (c *Connection) WriteRequestedCellsFrom(index CellIndex) error {
 	c.filterSetMutex.Lock()
 	defer c.filterSetMutex.Unlock()
 
@@ -50,11 +62,23 @@ func (c *Connection) WriteRequestedCells(cells []*proto.Cell) error {
 		return nil
 	}
 
+	var cells []*proto.Cell
+	if region, ok := filters.RegionOf(c.FilterSet); ok {
+		cells = index.CellsIn(region)
+	} else {
+		cells = index.AllCells()
+	}
+
 	message := &Message{}
+	seenWarnings := map[string]bool{}
 	for _, cell := range cells {
 		passes, warnings := c.FilterSet.Eval(cell)
-		if len(warnings) > 0 {
-			message.Warnings = append(message.Warnings, warnings...)
+		for _, warning := range warnings {
+			//most warnings are the same for many cells, they are sent once per message
+			if !seenWarnings[warning] {
+				seenWarnings[warning] = true
+				message.Warnings = append(message.Warnings, warning)
+			}
 		}
 
 		if passes {
@@ -62,30 +86,43 @@ func (c *Connection) WriteRequestedCells(cells []*proto.Cell) error {
 		}
 	}
 
+	return c.writeJSON(message)
+}
+
+func (c *Connection) writeJSON(v interface{}) error {
 	c.writeMutex.Lock()
 	defer c.writeMutex.Unlock()
 
-	return c.Conn.WriteJSON(message)
+	return c.Conn.WriteJSON(v)
 }
 
-//Listen for incoming definitions
+//Listen for incoming filters, see filters.Parse for the accepted forms.
+//Every filter is answered with a FilterReply, a rejected filter leaves the previous one in place
 func (c *Connection) Listen() {
 	for {
-		definitions := &[]*filters.FilterDefinition{}
-		err := c.Conn.ReadJSON(definitions)
+		_, message, err := c.Conn.ReadMessage()
 		if err != nil {
 			if c.onListenErrorHandler != nil {
 				c.onListenErrorHandler(err)
 			} else {
-				fmt.Println(err, " not given to error handler")
+				c.logger().WithError(err).Warn("listen error not given to an error handler")
 			}
 			break
 		}
 
-		if definitions != nil && len(*definitions) > 0 {
-			c.filterSetMutex.Lock()
-			c.FilterSet = filters.SetFromDefinitions(*definitions)
-			c.filterSetMutex.Unlock()
+		evaluator, validationErr := filters.Validate(message)
+		if validationErr != nil {
+			c.logger().WithError(validationErr).Info("rejected invalid filter")
+		}
+
+		//the reply is written while holding the lock, so no cells filtered by the new filter are sent before it
+		c.filterSetMutex.Lock()
+		if validationErr == nil {
+			c.FilterSet = evaluator
+		}
+		if err := c.writeJSON(newFilterReply(validationErr)); err != nil {
+			c.logger().WithError(err).Info("couldn't reply to filter")
 		}
+		c.filterSetMutex.Unlock()
 	}
 }
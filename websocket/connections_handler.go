@@ -1,16 +1,18 @@
 package websocket
 
 import (
-	"fmt"
-	"github.com/codeuniversity/al-master/metrics"
-	"log"
 	"sync"
 
 	"github.com/gorilla/websocket"
 
+	"github.com/codeuniversity/al-master/logging"
+	"github.com/codeuniversity/al-master/metrics"
 	"github.com/codeuniversity/al-proto"
 )
 
+//websocketLogger logs connections coming and going
+var websocketLogger = logging.For("websocket")
+
 //ConnectionsHandler holds all connections and handles removing dead connections
 type ConnectionsHandler struct {
 	conns    []*Connection
@@ -32,7 +34,7 @@ func (h *ConnectionsHandler) Shutdown() {
 func (h *ConnectionsHandler) closeActiveConnections() {
 	for _, conn := range h.conns {
 		if err := conn.Conn.Close(); err != nil {
-			log.Println("Couldn't close websocket connection", err)
+			conn.logger().WithError(err).Warn("couldn't close websocket connection")
 		}
 	}
 }
@@ -41,7 +43,7 @@ func (h *ConnectionsHandler) closeActiveConnections() {
 func (h *ConnectionsHandler) AddConnection(conn *websocket.Conn) {
 	connectionWrapper := NewConnection(conn)
 	connectionWrapper.OnListenError(func(listenErr error) {
-		fmt.Println("removing connection because: ", listenErr)
+		connectionWrapper.logger().WithError(listenErr).Info("removing connection")
 		h.removeConnection(connectionWrapper)
 		metrics.WebSocketConnectionsCount.Dec()
 	})
@@ -51,18 +53,26 @@ func (h *ConnectionsHandler) AddConnection(conn *websocket.Conn) {
 
 	h.conns = append(h.conns, connectionWrapper)
 	metrics.WebSocketConnectionsCount.Inc()
+	connectionWrapper.logger().Info("connection added")
 }
 
 //BroadcastCells to all connected clients
 func (h *ConnectionsHandler) BroadcastCells(cells []*proto.Cell) {
+	h.BroadcastIndex(cellSlice(cells))
+}
+
+//BroadcastIndex to all connected clients. Connections with a region filter only look at the cells the index
+//returns for their region
+func (h *ConnectionsHandler) BroadcastIndex(cellIndex CellIndex) {
 	h.connLock.Lock()
 	defer h.connLock.Unlock()
+	sharedIndex := &sharedCellIndex{CellIndex: cellIndex}
 	indicesToRemove := []int{}
 	for index, conn := range h.conns {
-		err := conn.WriteRequestedCells(cells)
+		err := conn.WriteRequestedCellsFrom(sharedIndex)
 		if err != nil {
 			//assume connection is dead
-			fmt.Println(err)
+			conn.logger().WithError(err).Info("removing connection that couldn't be written to")
 			indicesToRemove = append(indicesToRemove, index)
 		}
 	}
@@ -0,0 +1,34 @@
+package websocket
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/codeuniversity/al-master/filters"
+)
+
+//maxFilterSize of a filter sent to ValidateFilterHandler
+const maxFilterSize = 1 << 20
+
+//ValidateFilterHandler answers a filter POSTed as request body with the FilterReply a websocket client would get for it.
+//Rejected filters are answered with status 422
+func ValidateFilterHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	message, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxFilterSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	_, validationErr := filters.Validate(message)
+	w.Header().Set("Content-Type", "application/json")
+	if validationErr != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	json.NewEncoder(w).Encode(newFilterReply(validationErr))
+}
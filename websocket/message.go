@@ -1,6 +1,7 @@
 package websocket
 
 import (
+	"github.com/codeuniversity/al-master/filters"
 	"github.com/codeuniversity/al-proto"
 )
 
@@ -9,3 +10,23 @@ type Message struct {
 	Cells    []*proto.Cell `json:"cells"`
 	Warnings []string      `json:"warnings"`
 }
+
+//Types of a FilterReply
+const (
+	FilterAccepted = "filter_accepted"
+	FilterRejected = "filter_rejected"
+)
+
+//FilterReply is sent to the client once for every filter it sends, before any Message filtered by it
+type FilterReply struct {
+	Type  string                   `json:"type"`
+	Error *filters.ValidationError `json:"error,omitempty"`
+}
+
+//newFilterReply accepting the filter, unless validationErr is set
+func newFilterReply(validationErr *filters.ValidationError) *FilterReply {
+	if validationErr != nil {
+		return &FilterReply{Type: FilterRejected, Error: validationErr}
+	}
+	return &FilterReply{Type: FilterAccepted}
+}
@@ -0,0 +1,117 @@
+package master
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codeuniversity/al-master/filters"
+	"github.com/codeuniversity/al-proto"
+	websocketConn "github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//websocketFrame is either a FilterReply or a Message
+type websocketFrame struct {
+	Type     string                   `json:"type"`
+	Error    *filters.ValidationError `json:"error"`
+	Cells    []*proto.Cell            `json:"cells"`
+	Warnings []string                 `json:"warnings"`
+}
+
+func sendFilter(t *testing.T, conn *websocketConn.Conn, filter string) *websocketFrame {
+	require.NoError(t, conn.WriteMessage(websocketConn.TextMessage, []byte(filter)))
+	return readFrame(t, conn)
+}
+
+func readFrame(t *testing.T, conn *websocketConn.Conn) *websocketFrame {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(stepDeadlockTimeout)))
+	frame := &websocketFrame{}
+	require.NoError(t, conn.ReadJSON(frame))
+	return frame
+}
+
+func TestWebsocketFilters(t *testing.T) {
+	slave := startFakeSlave(t, 0)
+	defer slave.grpcServer.Stop()
+
+	s := startTestServer(t, testServerConfig(), slave)
+	defer s.closeConnections()
+
+	conn, _, err := websocketConn.DefaultDialer.Dial(fmt.Sprintf("ws://%v/", s.HTTPAddr()), nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	reply := sendFilter(t, conn, "cell.pos.w < 5")
+	assert.Equal(t, "filter_rejected", reply.Type)
+	require.NotNil(t, reply.Error.Pos)
+	assert.Equal(t, 0, *reply.Error.Pos)
+
+	reply = sendFilter(t, conn, `[{"left_hand": "cell.pos.x", "left_hand_type": "coordinate", "operator": "<", "right_hand": "1", "right_hand_type": "unmber"}]`)
+	assert.Equal(t, "filter_rejected", reply.Type)
+	assert.Equal(t, map[int][]string{0: {"right hand {1 unmber} is invalid"}}, reply.Error.Definitions)
+
+	reply = sendFilter(t, conn, `[null]`)
+	assert.Equal(t, "filter_rejected", reply.Type)
+	assert.Equal(t, map[int][]string{0: {"definition is null"}}, reply.Error.Definitions)
+
+	reply = sendFilter(t, conn, "cell.energy / 0 > 1")
+	assert.Equal(t, "filter_accepted", reply.Type)
+	s.broadcastCurrentState()
+	message := readFrame(t, conn)
+	assert.Empty(t, message.Cells)
+	assert.Equal(t, []string{"cell.energy / 0 (division by zero) is invalid"}, message.Warnings, "warnings are sent once per message")
+
+	reply = sendFilter(t, conn, "cell.pos.w < 5")
+	assert.Equal(t, "filter_rejected", reply.Type)
+	s.broadcastCurrentState()
+	message = readFrame(t, conn)
+	assert.Len(t, message.Warnings, 1, "the previous filter stays in place")
+
+	reply = sendFilter(t, conn, `{"region": {"type": "sphere", "center": [0, 0, 0], "radius": 1000000}}`)
+	assert.Equal(t, "filter_accepted", reply.Type)
+	s.broadcastCurrentState()
+	message = readFrame(t, conn)
+	assert.Len(t, message.Cells, len(s.CellBuckets.AllCells()))
+	assert.Empty(t, message.Warnings)
+}
+
+func TestFilterValidationEndpoint(t *testing.T) {
+	slave := startFakeSlave(t, 0)
+	defer slave.grpcServer.Stop()
+
+	s := startTestServer(t, testServerConfig(), slave)
+	defer s.closeConnections()
+	url := fmt.Sprintf("http://%v/filters/validate", s.HTTPAddr())
+
+	response, err := http.Post(url, "text/plain", strings.NewReader("cell.pos.x < 5 and not cell.dying"))
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	response, err = http.Post(url, "text/plain", strings.NewReader("cell.pos.x <"))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+	reply := &websocketFrame{}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(reply))
+	assert.Equal(t, "filter_rejected", reply.Type)
+	assert.Equal(t, "position 12: expected a number, string, bool, field or function but got end of expression", reply.Error.Msg)
+
+	response, err = http.Post(url, "application/json", strings.NewReader(`[null]`))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+	reply = &websocketFrame{}
+	require.NoError(t, json.NewDecoder(response.Body).Decode(reply))
+	assert.Equal(t, "invalid filter definitions at index 0", reply.Error.Msg)
+
+	response, err = http.Get(url)
+	require.NoError(t, err)
+	response.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, response.StatusCode)
+}